@@ -0,0 +1,139 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+// #include <nanomsg/nn.h>
+import "C"
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Addr is a parsed nanomsg endpoint address. The address consists of two
+// parts as follows: 'transport'://'address'. The meaning of the address part
+// depends on the transport:
+//
+//	inproc://name
+//	ipc://path
+//	tcp://[interface;]host:port
+//	ws://[interface;]host:port[/path]
+//
+// When binding, the host is the local interface to bind to, or * for all
+// interfaces. When connecting, the host is the remote peer and the optional
+// interface is the local interface to connect from.
+type Addr struct {
+	// Transport is one of "inproc", "ipc", "tcp" or "ws".
+	Transport string
+	// Iface is the local interface a tcp or ws connection is made from.
+	Iface string
+	// Host and Port are used by the tcp and ws transports.
+	Host string
+	Port int
+	// Path is the name for inproc, the file system path for ipc and the
+	// resource path for ws.
+	Path string
+}
+
+// AddrError is returned when an address can not be parsed.
+type AddrError struct {
+	Addr   string
+	Reason string
+	// Err is the error nanomsg would return for the address.
+	Err error
+}
+
+func (e *AddrError) Error() string {
+	return "nanomsg: invalid address " + strconv.Quote(e.Addr) + ": " + e.Reason
+}
+
+func (e *AddrError) Unwrap() error {
+	return e.Err
+}
+
+// ParseAddr parses and validates the address.
+func ParseAddr(address string) (*Addr, error) {
+	fail := func(reason string) (*Addr, error) {
+		return nil, &AddrError{address, reason, syscall.EINVAL}
+	}
+	if len(address) >= C.NN_SOCKADDR_MAX {
+		return nil, &AddrError{address, "address too long", syscall.ENAMETOOLONG}
+	}
+	i := strings.Index(address, "://")
+	if i < 0 {
+		return fail("missing transport")
+	}
+	a := &Addr{Transport: address[:i]}
+	rest := address[i+3:]
+
+	switch a.Transport {
+	case "inproc", "ipc":
+		if rest == "" {
+			return fail("missing " + a.Transport + " path")
+		}
+		a.Path = rest
+		return a, nil
+	case "tcp", "ws":
+	default:
+		return nil, &AddrError{address, "unknown transport " + strconv.Quote(a.Transport), syscall.EPROTONOSUPPORT}
+	}
+
+	if i := strings.IndexByte(rest, ';'); i >= 0 {
+		a.Iface, rest = rest[:i], rest[i+1:]
+		if a.Iface == "" {
+			return fail("missing interface")
+		}
+	}
+	if a.Transport == "ws" {
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			a.Path, rest = rest[i:], rest[:i]
+		}
+	}
+	i = strings.LastIndexByte(rest, ':')
+	if i < 0 {
+		return fail("missing port")
+	}
+	a.Host = rest[:i]
+	if strings.HasPrefix(a.Host, "[") {
+		if !strings.HasSuffix(a.Host, "]") {
+			return fail("invalid IPv6 address")
+		}
+		a.Host = a.Host[1 : len(a.Host)-1]
+	}
+	if a.Host == "" {
+		return fail("missing host")
+	}
+	port := rest[i+1:]
+	if port == "" || strings.Trim(port, "0123456789") != "" {
+		return fail("invalid port " + strconv.Quote(port))
+	}
+	var err error
+	if a.Port, err = strconv.Atoi(port); err != nil || a.Port > 0xffff {
+		return fail("invalid port " + strconv.Quote(port))
+	}
+	return a, nil
+}
+
+// Network returns the transport of the address. Together with String it makes
+// Addr implement net.Addr.
+func (a *Addr) Network() string {
+	return a.Transport
+}
+
+// String returns the address in the form accepted by Bind and Connect.
+func (a *Addr) String() string {
+	switch a.Transport {
+	case "tcp", "ws":
+		host := a.Host
+		if strings.IndexByte(host, ':') >= 0 {
+			host = "[" + host + "]"
+		}
+		s := a.Transport + "://"
+		if a.Iface != "" {
+			s += a.Iface + ";"
+		}
+		return s + host + ":" + strconv.Itoa(a.Port) + a.Path
+	}
+	return a.Transport + "://" + a.Path
+}
@@ -0,0 +1,120 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseAddr(t *testing.T) {
+	var tests = []struct {
+		address string
+		addr    Addr
+	}{
+		{"inproc://a", Addr{Transport: "inproc", Path: "a"}},
+		{"ipc:///tmp/test.ipc", Addr{Transport: "ipc", Path: "/tmp/test.ipc"}},
+		{"tcp://*:5555", Addr{Transport: "tcp", Host: "*", Port: 5555}},
+		{"tcp://127.0.0.1:0", Addr{Transport: "tcp", Host: "127.0.0.1"}},
+		{"tcp://eth0;example.com:5555", Addr{Transport: "tcp", Iface: "eth0", Host: "example.com", Port: 5555}},
+		{"tcp://[::1]:5555", Addr{Transport: "tcp", Host: "::1", Port: 5555}},
+		{"ws://example.com:80", Addr{Transport: "ws", Host: "example.com", Port: 80}},
+		{"ws://127.0.0.1;example.com:80/chat", Addr{Transport: "ws", Iface: "127.0.0.1", Host: "example.com", Port: 80, Path: "/chat"}},
+	}
+	for _, test := range tests {
+		addr, err := ParseAddr(test.address)
+		if err != nil {
+			t.Errorf("%s: %v", test.address, err)
+			continue
+		}
+		if *addr != test.addr {
+			t.Errorf("%s: unexpected addr: %+v", test.address, *addr)
+		}
+		if s := addr.String(); s != test.address {
+			t.Errorf("%s: unexpected string: %s", test.address, s)
+		}
+	}
+}
+
+func TestParseAddrError(t *testing.T) {
+	var tests = []struct {
+		address string
+		reason  string
+		err     error
+	}{
+		{"", "missing transport", syscall.EINVAL},
+		{"tcp:/127.0.0.1:5555", "missing transport", syscall.EINVAL},
+		{"udp://127.0.0.1:5555", "unknown transport", syscall.EPROTONOSUPPORT},
+		{"inproc://", "missing inproc path", syscall.EINVAL},
+		{"tcp://127.0.0.1", "missing port", syscall.EINVAL},
+		{"tcp://:5555", "missing host", syscall.EINVAL},
+		{"tcp://127.0.0.1:55x5", "invalid port", syscall.EINVAL},
+		{"tcp://127.0.0.1:65536", "invalid port", syscall.EINVAL},
+		{"tcp://[::1:5555", "invalid IPv6 address", syscall.EINVAL},
+		{"tcp://;127.0.0.1:5555", "missing interface", syscall.EINVAL},
+		{"ipc://" + strings.Repeat("a", 128), "address too long", syscall.ENAMETOOLONG},
+	}
+	for _, test := range tests {
+		_, err := ParseAddr(test.address)
+		if aerr, ok := err.(*AddrError); !ok {
+			t.Errorf("%s: unexpected error: %v", test.address, err)
+		} else if !strings.HasPrefix(aerr.Reason, test.reason) || aerr.Err != test.err {
+			t.Errorf("%s: unexpected error: %v (%v)", test.address, aerr, aerr.Err)
+		}
+	}
+}
+
+func TestBindConnectAddr(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err = s.Bind("tcp://eth0;127.0.0.1:5555"); err == nil {
+		t.Error("expected bind failure")
+	}
+	if _, err = s.Connect("tcp://127.0.0.1:0"); err == nil {
+		t.Error("expected connect failure")
+	}
+	ep, err := s.Bind("inproc://addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.Addr.Transport != "inproc" || ep.Addr.Path != "addr" {
+		t.Errorf("unexpected addr: %+v", ep.Addr)
+	}
+}
+
+func TestBindEphemeral(t *testing.T) {
+	rep, err := NewRepSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rep.Close()
+	ep, err := rep.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.Addr.Port == 0 || ep.Address != ep.Addr.String() {
+		t.Fatalf("port not resolved: %s", ep.Address)
+	}
+
+	req, err := NewReqSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer req.Close()
+	if _, err = req.Connect(ep.Address); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = req.Send([]byte("ping"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := rep.Recv(0); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "ping" {
+		t.Errorf("unexpected data: %s", data)
+	}
+}
@@ -16,7 +16,7 @@ type BusSocket struct {
 // NewBusSocket creates a socket where sent messages are distributed to all
 // nodes in the topology. Incoming messages from all other nodes in the
 // topology are fair-queued in the socket.
-func NewBusSocket() (*BusSocket, error) {
-	socket, err := NewSocket(AF_SP, BUS)
+func NewBusSocket(opts ...SocketOption) (*BusSocket, error) {
+	socket, err := NewSocket(AF_SP, BUS, opts...)
 	return &BusSocket{socket}, err
 }
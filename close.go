@@ -0,0 +1,106 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// gracefulPollInterval is how often CloseGracefully checks for outstanding
+// sends.
+const gracefulPollInterval = 10 * time.Millisecond
+
+// CloseGracefully closes the socket without losing messages. It stops the
+// socket from accepting new sends, which fail with an error matching
+// ErrClosed, waits for sends already in progress to be handed over to nanomsg
+// and for the messages sent to be flushed to the peers. If drain is not nil,
+// it is then called with each inbound message buffered on the socket. Finally
+// the socket is closed.
+//
+// nanomsg does not report how many messages are waiting in its buffers. For
+// PUSH, PAIR and REQ sockets, which hand each message to a single peer, the
+// messages are considered flushed once the socket accepts another message
+// without blocking, i.e. once a peer has room for it. With several peers this
+// only guarantees that one of them has. Other protocols do not wait for
+// flushing, as they either drop messages peers have no room for or can not
+// send freely.
+//
+// If the context has no deadline, the wait is limited to the send timeout of
+// the socket. With the default, infinite, send timeout a deadline is required
+// to not wait forever for a peer that never shows up.
+//
+// If the context is done before the messages are flushed, the socket is closed
+// anyway, which makes the remaining sends fail, and the error of the context
+// is returned.
+func (s *Socket) CloseGracefully(ctx context.Context, drain func([]byte)) error {
+	if _, ok := ctx.Deadline(); !ok {
+		if timeout, err := s.SendTimeout(); err == nil && timeout >= 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	s.closing.Store(true)
+	s.log(slog.LevelInfo, "nanomsg: closing socket gracefully")
+
+	err := s.waitSends(ctx)
+	if err == nil {
+		err = s.waitFlushed(ctx)
+	}
+	if err == nil && drain != nil {
+		for ctx.Err() == nil {
+			data, err := s.Recv(DontWait)
+			if err != nil {
+				break
+			}
+			drain(data)
+		}
+	}
+	if cerr := s.Close(); cerr != nil {
+		// The socket is still open, so it accepts sends again.
+		s.closing.Store(false)
+		return errors.Join(err, cerr)
+	}
+	return err
+}
+
+// waitSends blocks until there are no sends in progress on the socket.
+func (s *Socket) waitSends(ctx context.Context) error {
+	ticker := time.NewTicker(gracefulPollInterval)
+	defer ticker.Stop()
+	for s.sending.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// waitFlushed blocks until the socket accepts another message without
+// blocking, for the protocols where that means the messages sent have been
+// handed to the peers. See CloseGracefully.
+func (s *Socket) waitFlushed(ctx context.Context) error {
+	switch s.protocol {
+	case PUSH, PAIR, REQ:
+	default:
+		return nil
+	}
+	if sent, err := s.Statistic(StatMessagesSent); err != nil || sent == 0 {
+		return err
+	}
+	var poller Poller
+	item := poller.Add(s, false, true)
+	for ctx.Err() == nil {
+		if _, err := poller.Poll(gracefulPollInterval); err != nil {
+			return err
+		} else if item.CanSend() {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,147 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseGracefully(t *testing.T) {
+	a, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Bind("inproc://graceful"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Connect("inproc://graceful"); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if _, err = a.Send([]byte(msg), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var drained [][]byte
+	if err = b.CloseGracefully(context.Background(), func(data []byte) {
+		drained = append(drained, data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.Join(drained, []byte(" ")), []byte("one two three")) {
+		t.Errorf("unexpected drained messages: %q", drained)
+	}
+	if _, err = b.Send([]byte("four"), 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCloseGracefullyTimeout(t *testing.T) {
+	push, err := NewPushSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan error)
+	go func() {
+		_, err := push.Send([]byte("nobody listens"), 0)
+		sent <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = push.CloseGracefully(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = <-sent; !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected send error: %v", err)
+	}
+}
+
+// fullPipeline returns a PUSH socket connected to a PULL socket whose buffer
+// is full, so that the PUSH socket has messages it can not flush.
+func fullPipeline(t *testing.T, address string, opts ...SocketOption) (*PushSocket, *PullSocket) {
+	t.Helper()
+	pull, err := NewPullSocket(WithRecvBuffer(128), WithRecvTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pull.Close() })
+	if _, err = pull.Bind(address); err != nil {
+		t.Fatal(err)
+	}
+	push, err := NewPushSocket(append(opts, WithSendBuffer(128))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { push.Close() })
+	if _, err = push.Connect(address); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err = push.Send(bytes.Repeat([]byte("x"), 64), DontWait); errors.Is(err, ErrWouldBlock) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return push, pull
+}
+
+func TestCloseGracefullyFlush(t *testing.T) {
+	// The peer never makes room for the remaining message.
+	push, _ := fullPipeline(t, "inproc://flush-expired")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := push.CloseGracefully(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := push.Send([]byte("closed"), DontWait); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The peer starts receiving after a while, which flushes the messages.
+	push, pull := fullPipeline(t, "inproc://flush")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		for {
+			if _, err := pull.Recv(0); err != nil {
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := push.CloseGracefully(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("closed after %v, before the messages were flushed", elapsed)
+	}
+}
+
+func TestCloseGracefullySendTimeout(t *testing.T) {
+	// Without a deadline, the wait is limited to the send timeout.
+	push, _ := fullPipeline(t, "inproc://flush-timeout", WithSendTimeout(20*time.Millisecond))
+	done := make(chan error)
+	go func() { done <- push.CloseGracefully(context.Background(), nil) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CloseGracefully did not return")
+	}
+}
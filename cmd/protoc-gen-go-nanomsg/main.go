@@ -0,0 +1,135 @@
+// Command protoc-gen-go-nanomsg is a protoc plugin generating typed clients and
+// servers for the services of .proto files, calling methods over nanomsg
+// REQ/REP sockets using the rpc package.
+//
+// Install it, and run protoc with the --go-nanomsg_out flag along with the
+// --go_out flag generating the messages:
+//
+//	$ go install github.com/op/go-nanomsg/cmd/protoc-gen-go-nanomsg
+//	$ protoc --go_out=. --go-nanomsg_out=. greeter.proto
+//
+// For a service named Greeter, the generated code contains:
+//
+//   - GreeterServer, the interface implemented by servers.
+//   - RegisterGreeterServer, registering the methods of a server on an
+//     rpc.Server, and ServeGreeter, serving them on a *nanomsg.RepSocket.
+//   - GreeterClient and NewGreeterClient, calling the methods over a
+//     *nanomsg.ReqSocket.
+//
+// Messages are encoded using protocodec.MessageCodec. Methods are named
+// after the service like in gRPC, e.g. "/helloworld.Greeter/SayHello".
+// Streaming methods are not supported.
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+const (
+	contextPackage    = protogen.GoImportPath("context")
+	nanomsgPackage    = protogen.GoImportPath("github.com/op/go-nanomsg")
+	protocodecPackage = protogen.GoImportPath("github.com/op/go-nanomsg/protocodec")
+	rpcPackage        = protogen.GoImportPath("github.com/op/go-nanomsg/rpc")
+)
+
+func main() {
+	var flags flag.FlagSet
+	protogen.Options{ParamFunc: flags.Set}.Run(func(gen *protogen.Plugin) error {
+		for _, f := range gen.Files {
+			if !f.Generate {
+				continue
+			}
+			if err := generateFile(gen, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// generateFile generates the clients and servers of the services in the file,
+// if it has any.
+func generateFile(gen *protogen.Plugin, file *protogen.File) error {
+	if len(file.Services) == 0 {
+		return nil
+	}
+	for _, service := range file.Services {
+		for _, method := range service.Methods {
+			if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+				return fmt.Errorf("%s: streaming methods are not supported", method.Desc.FullName())
+			}
+		}
+	}
+
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_nanomsg.pb.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-go-nanomsg. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	for _, service := range file.Services {
+		generateService(g, service)
+	}
+	return nil
+}
+
+// methodName returns the name the method is registered with on the server.
+func methodName(method *protogen.Method) string {
+	return fmt.Sprintf("/%s/%s", method.Parent.Desc.FullName(), method.Desc.Name())
+}
+
+func generateService(g *protogen.GeneratedFile, service *protogen.Service) {
+	var (
+		name    = service.GoName
+		ctx     = g.QualifiedGoIdent(contextPackage.Ident("Context"))
+		client  = g.QualifiedGoIdent(rpcPackage.Ident("Client"))
+		server  = g.QualifiedGoIdent(rpcPackage.Ident("Server"))
+		codec   = g.QualifiedGoIdent(protocodecPackage.Ident("MessageCodec"))
+		reqSock = g.QualifiedGoIdent(nanomsgPackage.Ident("ReqSocket"))
+		repSock = g.QualifiedGoIdent(nanomsgPackage.Ident("RepSocket"))
+	)
+
+	g.P()
+	g.P("// ", name, "Server is the server API for the ", name, " service.")
+	g.P(service.Comments.Leading, "type ", name, "Server interface {")
+	for _, method := range service.Methods {
+		g.P(method.Comments.Leading, method.GoName, "(", ctx, ", *", g.QualifiedGoIdent(method.Input.GoIdent), ") (*", g.QualifiedGoIdent(method.Output.GoIdent), ", error)")
+	}
+	g.P("}")
+	g.P()
+	g.P("// Register", name, "Server registers the methods of the ", name, " service on")
+	g.P("// s, which must use ", codec, ".")
+	g.P("func Register", name, "Server(s *", server, ", srv ", name, "Server) {")
+	for _, method := range service.Methods {
+		g.P(g.QualifiedGoIdent(rpcPackage.Ident("Register")), "(s, ", fmt.Sprintf("%q", methodName(method)), ", srv.", method.GoName, ")")
+	}
+	g.P("}")
+	g.P()
+	g.P("// Serve", name, " serves the ", name, " service on the REP socket until ctx is")
+	g.P("// done, see rpc.Server.Serve.")
+	g.P("func Serve", name, "(ctx ", ctx, ", rep *", repSock, ", srv ", name, "Server) error {")
+	g.P("s := ", g.QualifiedGoIdent(rpcPackage.Ident("NewServer")), "(", codec, "{})")
+	g.P("Register", name, "Server(s, srv)")
+	g.P("return s.Serve(ctx, rep)")
+	g.P("}")
+	g.P()
+	g.P("// ", name, "Client is the client API for the ", name, " service.")
+	g.P("type ", name, "Client struct {")
+	g.P("*", client)
+	g.P("}")
+	g.P()
+	g.P("// New", name, "Client creates a client calling the methods of the ", name)
+	g.P("// service over the REQ socket.")
+	g.P("func New", name, "Client(req *", reqSock, ") *", name, "Client {")
+	g.P("return &", name, "Client{", g.QualifiedGoIdent(rpcPackage.Ident("NewClient")), "(req, ", codec, "{})}")
+	g.P("}")
+	for _, method := range service.Methods {
+		input, output := g.QualifiedGoIdent(method.Input.GoIdent), g.QualifiedGoIdent(method.Output.GoIdent)
+		g.P()
+		g.P(method.Comments.Leading, "func (c *", name, "Client) ", method.GoName, "(ctx ", ctx, ", req *", input, ") (*", output, ", error) {")
+		g.P("return ", g.QualifiedGoIdent(rpcPackage.Ident("Call")), "[*", input, ", *", output, "](ctx, c.Client, ", fmt.Sprintf("%q", methodName(method)), ", req)")
+		g.P("}")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// greeterFile returns a file with a service using the wrapper messages, whose
+// Go code already exists.
+func greeterFile(streaming bool) *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("greeter.proto"),
+		Package:    proto.String("helloworld"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		Syntax:     proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String("example.com/greeter;greeter"),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:            proto.String("SayHello"),
+				InputType:       proto.String(".google.protobuf.StringValue"),
+				OutputType:      proto.String(".google.protobuf.StringValue"),
+				ServerStreaming: proto.Bool(streaming),
+			}},
+		}},
+	}
+}
+
+func generate(t *testing.T, file *descriptorpb.FileDescriptorProto) *pluginpb.CodeGeneratorResponse {
+	t.Helper()
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{file.GetName()},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(wrapperspb.File_google_protobuf_wrappers_proto),
+			file,
+		},
+	}
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range gen.Files {
+		if f.Generate {
+			if err = generateFile(gen, f); err != nil {
+				gen.Error(err)
+			}
+		}
+	}
+	return gen.Response()
+}
+
+func TestGenerate(t *testing.T) {
+	resp := generate(t, greeterFile(false))
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	} else if len(resp.File) != 1 {
+		t.Fatalf("unexpected files: %v", resp.File)
+	}
+	f := resp.File[0]
+	if f.GetName() != "example.com/greeter/greeter_nanomsg.pb.go" {
+		t.Errorf("unexpected name: %s", f.GetName())
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), f.GetName(), f.GetContent(), 0); err != nil {
+		t.Fatal(err)
+	}
+	// protogen names imported packages after the last element of their
+	// path, so the nanomsg package is imported as go_nanomsg.
+	for _, expected := range []string{
+		"SayHello(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)",
+		`rpc.Register(s, "/helloworld.Greeter/SayHello", srv.SayHello)`,
+		"func ServeGreeter(ctx context.Context, rep *go_nanomsg.RepSocket, srv GreeterServer) error {",
+		"func NewGreeterClient(req *go_nanomsg.ReqSocket) *GreeterClient {",
+		"rpc.NewServer(protocodec.MessageCodec{})",
+		`rpc.Call[*wrapperspb.StringValue, *wrapperspb.StringValue](ctx, c.Client, "/helloworld.Greeter/SayHello", req)`,
+	} {
+		if !strings.Contains(f.GetContent(), expected) {
+			t.Errorf("%q not generated:\n%s", expected, f.GetContent())
+		}
+	}
+}
+
+func TestGenerateStreaming(t *testing.T) {
+	resp := generate(t, greeterFile(true))
+	if !strings.Contains(resp.GetError(), "streaming methods are not supported") {
+		t.Errorf("unexpected error: %q", resp.GetError())
+	}
+}
@@ -0,0 +1,22 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"github.com/op/go-nanomsg/sp"
+)
+
+// Sender is implemented by sockets which messages can be sent on.
+type Sender = sp.Sender
+
+// Receiver is implemented by sockets which messages can be received from.
+type Receiver = sp.Receiver
+
+// Conn is a socket which messages can be sent on and received from. It is
+// implemented by Socket and the socket wrappers embedding it, as well as by
+// the in-memory sockets of the nanomsgtest package. The interfaces are
+// defined in the sp package, which does not need the nanomsg library, so code
+// using them can be built and tested without cgo.
+type Conn = sp.Conn
+
+var _ Conn = (*Socket)(nil)
@@ -0,0 +1,26 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"testing"
+
+	"github.com/op/go-nanomsg/nanomsgtest"
+	"github.com/op/go-nanomsg/sp"
+)
+
+var _ Conn = (*nanomsgtest.Socket)(nil)
+
+func TestSPConstants(t *testing.T) {
+	if sp.DontWait != DontWait {
+		t.Errorf("DontWait mismatch: %d != %d", sp.DontWait, DontWait)
+	}
+	if nanomsgtest.DontWait != DontWait {
+		t.Errorf("DontWait mismatch: %d != %d", nanomsgtest.DontWait, DontWait)
+	}
+	for errno, nn := range nnErrnos {
+		if errno != nn {
+			t.Errorf("%v mismatch: %d != %d", errno, errno, nn)
+		}
+	}
+}
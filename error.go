@@ -6,7 +6,10 @@ package nanomsg
 import "C"
 
 import (
+	"errors"
 	"syscall"
+
+	"github.com/op/go-nanomsg/sp"
 )
 
 // Errno defines specific nanomsg errors
@@ -14,28 +17,22 @@ import (
 // The errors returned from operations on the nanomsg library and the Go
 // bindings for it tries to return all errors using the errors already found in
 // Go like syscall.EADDRINUSE. There are some errors that only exists in
-// nanomsg and these are defined as Errno.
-type Errno syscall.Errno
+// nanomsg and these are defined as Errno. It is the same type as sp.Errno.
+type Errno = sp.Errno
 
 const (
 	nn_hausnumero = Errno(int(C.NN_HAUSNUMERO))
 
 	// Nanomsg specific errors
-	ETERM = Errno(int(C.ETERM))
-	EFSM  = Errno(int(C.EFSM))
+	ETERM = sp.ETERM
+	EFSM  = sp.EFSM
 )
 
-var errorStrings = map[Errno]string{
-	ETERM: C.GoString(C.nn_strerror(C.ETERM)),
-	EFSM:  C.GoString(C.nn_strerror(C.EFSM)),
-}
-
-func (e Errno) Error() string {
-	s := errorStrings[e]
-	if s == "" {
-		s = C.GoString(C.nn_strerror(C.int(e)))
-	}
-	return s
+// nnErrnos maps the nanomsg specific errors to the values defined by the C
+// library, which must be the same.
+var nnErrnos = map[Errno]Errno{
+	ETERM: Errno(int(C.ETERM)),
+	EFSM:  Errno(int(C.EFSM)),
 }
 
 // Errors expected to be found when calling the nanomsg library should map
@@ -94,3 +91,91 @@ func nnError(err error) error {
 	}
 	return err
 }
+
+// These errors are matched by errors.Is for the errors returned by operations
+// on sockets, making it possible to handle them the same way regardless of
+// which operation or socket type they came from. They are the same values as
+// in the sp package.
+var (
+	// ErrTimeout is matched when an operation did not complete in time; a
+	// send or receive timeout or an expired survey deadline.
+	ErrTimeout = sp.ErrTimeout
+	// ErrWouldBlock is matched when an operation using DontWait could not
+	// be performed straight away.
+	ErrWouldBlock = sp.ErrWouldBlock
+	// ErrSurveyExpired is matched when the deadline of a survey expired
+	// while receiving responses on a SURVEYOR socket.
+	ErrSurveyExpired = sp.ErrSurveyExpired
+	// ErrClosed is matched when the socket, or the library, is closed.
+	ErrClosed = sp.ErrClosed
+)
+
+// OpError is the error type returned by operations on sockets. It describes
+// the operation and the socket the error happened on. The underlying error,
+// usually a syscall.Errno or Errno, is available using errors.Unwrap.
+type OpError struct {
+	// Op is the operation which failed, e.g. "bind", "send" or "setsockopt".
+	Op string
+	// Socket is the name of the socket, see Socket.Name.
+	Socket   string
+	Protocol Protocol
+	// Addr is the endpoint address for bind, connect and shutdown.
+	Addr string
+	// Option is the name of the option for getsockopt and setsockopt.
+	Option string
+	Err    error
+}
+
+func (e *OpError) Error() string {
+	s := "nanomsg: " + e.Op
+	if e.Option != "" {
+		s += " " + e.Option
+	}
+	if e.Addr != "" {
+		s += " " + e.Addr
+	}
+	if e.Socket != "" {
+		s += " (" + e.Protocol.String() + " socket " + e.Socket + ")"
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is match the error with ErrTimeout, ErrWouldBlock,
+// ErrSurveyExpired and ErrClosed.
+func (e *OpError) Is(target error) bool {
+	if target == ErrSurveyExpired {
+		return e.Op == "recv" && e.Protocol == SURVEYOR && errors.Is(e.Err, syscall.ETIMEDOUT)
+	}
+	return sp.MatchErrno(e.Err, target)
+}
+
+// Timeout returns true if the error is caused by a timeout.
+func (e *OpError) Timeout() bool {
+	t, ok := e.Err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// Temporary returns true if the operation may succeed if tried again.
+func (e *OpError) Temporary() bool {
+	t, ok := e.Err.(interface{ Temporary() bool })
+	return ok && t.Temporary()
+}
+
+// opError returns an *OpError for an operation on the socket.
+func (s *Socket) opError(op, addr string, err error) *OpError {
+	s.mu.Lock()
+	name := s.name
+	s.mu.Unlock()
+	return &OpError{Op: op, Socket: name, Protocol: s.protocol, Addr: addr, Err: err}
+}
+
+// optionError returns an *OpError for an operation on a socket option.
+func (s *Socket) optionError(op string, level, option C.int, err error) *OpError {
+	e := s.opError(op, "", err)
+	e.Option = optionSymbol(level, option)
+	return e
+}
@@ -3,6 +3,8 @@
 package nanomsg
 
 import (
+	"errors"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -21,7 +23,7 @@ func TestError(t *testing.T) {
 	if _, err = s.Bind("inproc://a"); err == nil {
 		t.Fatal("expected failure")
 	} else {
-		if err != syscall.EADDRINUSE {
+		if !errors.Is(err, syscall.EADDRINUSE) {
 			t.Fatal(err)
 		}
 	}
@@ -29,7 +31,7 @@ func TestError(t *testing.T) {
 	if err = s.SetRecvTimeout(1 * time.Millisecond); err != nil {
 		t.Fatal(err)
 	}
-	if _, err = s.Recv(0); err != syscall.ETIMEDOUT {
+	if _, err = s.Recv(0); !errors.Is(err, syscall.ETIMEDOUT) {
 		t.Fatal(err)
 	}
 
@@ -37,3 +39,176 @@ func TestError(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestOpError(t *testing.T) {
+	s, err := NewSocket(AF_SP, REP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = s.SetName("op-sock"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Bind("inproc://op"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Bind("inproc://op")
+	var oerr *OpError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oerr.Op != "bind" || oerr.Addr != "inproc://op" || oerr.Socket != "op-sock" || oerr.Protocol != REP {
+		t.Errorf("unexpected error: %+v", oerr)
+	}
+	expected := "nanomsg: bind inproc://op (REP socket op-sock): " + syscall.EADDRINUSE.Error()
+	if oerr.Error() != expected {
+		t.Errorf("unexpected message: %s", oerr)
+	}
+
+	if err = s.SetRecvTimeout(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Recv(0)
+	if !errors.As(err, &oerr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oerr.Op != "recv" || !oerr.Timeout() || !oerr.Temporary() {
+		t.Errorf("unexpected error: %+v", oerr)
+	}
+
+	_, err = s.SockOptInt(-42, 1)
+	if !errors.As(err, &oerr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oerr.Op != "getsockopt" || oerr.Option != "-42/1" || oerr.Timeout() {
+		t.Errorf("unexpected error: %+v", oerr)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	s, err := NewPairSocket(WithRecvTimeout(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Recv(0); !errors.Is(err, ErrTimeout) || errors.Is(err, ErrWouldBlock) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err = s.Recv(DontWait); !errors.Is(err, ErrWouldBlock) || errors.Is(err, ErrTimeout) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Send([]byte("abc"), 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	surveyor, err := NewSurveyorSocket(WithDeadline(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer surveyor.Close()
+	if _, err = surveyor.Bind("inproc://sentinel"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = surveyor.Send([]byte("survey"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err = surveyor.Recv(0)
+	if !errors.Is(err, ErrSurveyExpired) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// nanomsg is likely to hand out the closed socket's integer again.
+	s2, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+
+	if _, err = s.Send([]byte("abc"), DontWait); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected send error: %v", err)
+	}
+	if _, err = s.Recv(DontWait); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected recv error: %v", err)
+	}
+	if _, err = s.Bind("inproc://closed"); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected bind error: %v", err)
+	}
+	if _, err = s.Connect("inproc://closed"); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected connect error: %v", err)
+	}
+	if err = s.SetName("closed"); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected setsockopt error: %v", err)
+	}
+	if _, err = s.Linger(); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected getsockopt error: %v", err)
+	}
+	if name, err := s2.Name(); err != nil || name == "closed" {
+		t.Errorf("unexpected name of new socket: %q, %v", name, err)
+	}
+}
+
+func TestCloseInFlight(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		go func() {
+			_, err := s.Recv(0)
+			errs <- err
+		}()
+		go func() {
+			for {
+				_, err := s.Send([]byte("stray"), DontWait)
+				if !errors.Is(err, ErrWouldBlock) {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Calls in flight must not end up on a new socket given the same integer,
+	// where the receives would block.
+	s2, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	for i := 0; i < 16; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrClosed) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("call in flight did not return")
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+// #include <nanomsg/nn.h>
+import "C"
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Statistic identifies one of the statistics nanomsg keeps for each socket.
+type Statistic int
+
+const (
+	StatEstablishedConnections = Statistic(C.NN_STAT_ESTABLISHED_CONNECTIONS)
+	StatAcceptedConnections    = Statistic(C.NN_STAT_ACCEPTED_CONNECTIONS)
+	StatDroppedConnections     = Statistic(C.NN_STAT_DROPPED_CONNECTIONS)
+	StatBrokenConnections      = Statistic(C.NN_STAT_BROKEN_CONNECTIONS)
+	StatConnectErrors          = Statistic(C.NN_STAT_CONNECT_ERRORS)
+	StatBindErrors             = Statistic(C.NN_STAT_BIND_ERRORS)
+	StatAcceptErrors           = Statistic(C.NN_STAT_ACCEPT_ERRORS)
+	StatCurrentConnections     = Statistic(C.NN_STAT_CURRENT_CONNECTIONS)
+	StatInProgressConnections  = Statistic(C.NN_STAT_INPROGRESS_CONNECTIONS)
+	StatCurrentEndpointErrors  = Statistic(C.NN_STAT_CURRENT_EP_ERRORS)
+	StatMessagesSent           = Statistic(C.NN_STAT_MESSAGES_SENT)
+	StatMessagesReceived       = Statistic(C.NN_STAT_MESSAGES_RECEIVED)
+	StatBytesSent              = Statistic(C.NN_STAT_BYTES_SENT)
+	StatBytesReceived          = Statistic(C.NN_STAT_BYTES_RECEIVED)
+	StatCurrentSendPriority    = Statistic(C.NN_STAT_CURRENT_SND_PRIORITY)
+)
+
+// Statistic returns the current value of the statistic.
+func (s *Socket) Statistic(stat Statistic) (uint64, error) {
+	fd, err := s.hold()
+	if err != nil {
+		return 0, s.opError("statistic", "", err)
+	}
+	value, err := C.nn_get_statistic(fd, C.int(stat))
+	s.release()
+	if value == ^C.uint64_t(0) {
+		return 0, s.opError("statistic", "", s.callError(err))
+	}
+	return uint64(value), nil
+}
+
+// EventType is the type of a connection event.
+type EventType int
+
+const (
+	// EventConnected is sent when a connection to a peer is accepted or
+	// established.
+	EventConnected EventType = iota
+	// EventDisconnected is sent when a connection to a peer is dropped or
+	// broken.
+	EventDisconnected
+	// EventReconnected is sent instead of EventConnected when a connection
+	// is established after an earlier established connection was broken.
+	// nanomsg keeps statistics per socket, and broken accepted connections
+	// can not be told apart from broken established ones, so it is only sent
+	// by sockets without bound endpoints.
+	EventReconnected
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventReconnected:
+		return "reconnected"
+	}
+	return "EventType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Event describes a change in the connections of a socket.
+type Event struct {
+	Type EventType
+	// Connections is the number of connections the socket had when the
+	// event was detected.
+	Connections int
+}
+
+// eventPollInterval is how often the statistics are polled for changes.
+const eventPollInterval = 50 * time.Millisecond
+
+// Events returns a channel where connection events are delivered. nanomsg
+// does not report connection changes, so these are detected by polling the
+// socket statistics in the background. Events happening between two polls are
+// reported together, and events may be delivered late.
+//
+// The channel is closed when the socket is closed. As the background polling
+// keeps a reference to the socket, a socket which Events has been called on
+// has to be closed explicitly.
+func (s *Socket) Events() <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.events == nil {
+		s.events = make(chan Event, 64)
+		if s.closed() {
+			close(s.events)
+			return s.events
+		}
+		s.stopEvents = make(chan struct{})
+		s.eventsDone = make(chan struct{})
+		go s.pollEvents(s.events, s.stopEvents, s.eventsDone)
+	}
+	return s.events
+}
+
+// stopEventPolling stops the background polling started by Events, and waits
+// for it to finish.
+func (s *Socket) stopEventPolling() {
+	s.mu.Lock()
+	stop, done := s.stopEvents, s.eventsDone
+	s.stopEvents, s.eventsDone = nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// hasBoundEndpoints returns true if any endpoint was added using Bind.
+func (s *Socket) hasBoundEndpoints() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, endpoint := range s.endpoints {
+		if endpoint.bound {
+			return true
+		}
+	}
+	return false
+}
+
+// connStats holds the statistics used to detect connection events.
+type connStats struct {
+	established, accepted, dropped, broken, current uint64
+}
+
+func (s *Socket) connStats() (stats connStats, err error) {
+	for _, stat := range []struct {
+		value *uint64
+		stat  Statistic
+	}{
+		{&stats.established, StatEstablishedConnections},
+		{&stats.accepted, StatAcceptedConnections},
+		{&stats.dropped, StatDroppedConnections},
+		{&stats.broken, StatBrokenConnections},
+		{&stats.current, StatCurrentConnections},
+	} {
+		if *stat.value, err = s.Statistic(stat.stat); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Socket) pollEvents(events chan<- Event, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	defer close(events)
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	last, err := s.connStats()
+	if err != nil {
+		return
+	}
+	// broken is the number of broken connections not yet re-established. It
+	// is only tracked while all endpoints are connected.
+	var broken uint64
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		stats, err := s.connStats()
+		if err != nil {
+			return
+		}
+
+		var pending []Event
+		conns := int(stats.current)
+		for i := last.dropped + last.broken; i < stats.dropped+stats.broken; i++ {
+			pending = append(pending, Event{EventDisconnected, conns})
+		}
+		if s.hasBoundEndpoints() {
+			broken = 0
+		} else {
+			broken += stats.broken - last.broken
+		}
+		for i := last.established; i < stats.established; i++ {
+			if broken > 0 {
+				broken--
+				pending = append(pending, Event{EventReconnected, conns})
+			} else {
+				pending = append(pending, Event{EventConnected, conns})
+			}
+		}
+		for i := last.accepted; i < stats.accepted; i++ {
+			pending = append(pending, Event{EventConnected, conns})
+		}
+		last = stats
+
+		for _, event := range pending {
+			select {
+			case events <- event:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// waitConnectedInterval is how often WaitConnected checks the connections.
+const waitConnectedInterval = 10 * time.Millisecond
+
+// WaitConnected blocks until the socket has at least n connections, or until
+// the context is done.
+func (s *Socket) WaitConnected(ctx context.Context, n int) error {
+	ticker := time.NewTicker(waitConnectedInterval)
+	defer ticker.Stop()
+	for {
+		current, err := s.Statistic(StatCurrentConnections)
+		if err != nil {
+			return err
+		} else if current >= uint64(n) {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
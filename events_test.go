@@ -0,0 +1,124 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	push, err := NewPushSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer push.Close()
+	ep, err := push.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := push.Events()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	if err = push.WaitConnected(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cancel()
+
+	pull, err := NewPullSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pull.Connect(ep.Address); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = push.WaitConnected(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(typ EventType) {
+		select {
+		case event := <-events:
+			if event.Type != typ {
+				t.Errorf("unexpected event: %v", event.Type)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("timed out waiting for %v", typ)
+		}
+	}
+	expect(EventConnected)
+	if err = pull.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect(EventDisconnected)
+
+	if err = push.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range events {
+	}
+	if _, ok := <-push.Events(); ok {
+		t.Error("events delivered after close")
+	}
+}
+
+func TestEventsReconnected(t *testing.T) {
+	dir := t.TempDir()
+	expect := func(events <-chan Event, typ EventType) {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Type != typ {
+				t.Errorf("unexpected event: %v, expected %v", event.Type, typ)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("timed out waiting for %v", typ)
+		}
+	}
+	peer := func(protocol Protocol, bind bool, address string) *Socket {
+		s, err := NewSocket(AF_SP, protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bind {
+			_, err = s.Bind(address)
+		} else {
+			_, err = s.Connect(address)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// A broken accepted connection on a socket with bound endpoints is not
+	// taken for a broken established connection.
+	push := peer(PUSH, true, "ipc://"+dir+"/bound")
+	defer push.Close()
+	events := push.Events()
+	pull := peer(PULL, false, "ipc://"+dir+"/bound")
+	expect(events, EventConnected)
+	pull.Close()
+	expect(events, EventDisconnected)
+	pull = peer(PULL, true, "ipc://"+dir+"/other")
+	defer pull.Close()
+	if _, err := push.Connect("ipc://" + dir + "/other"); err != nil {
+		t.Fatal(err)
+	}
+	expect(events, EventConnected)
+
+	// A socket with only connected endpoints reports reconnects.
+	conn := peer(PULL, false, "ipc://"+dir+"/connected")
+	defer conn.Close()
+	events = conn.Events()
+	bound := peer(PUSH, true, "ipc://"+dir+"/connected")
+	expect(events, EventConnected)
+	bound.Close()
+	expect(events, EventDisconnected)
+	bound = peer(PUSH, true, "ipc://"+dir+"/connected")
+	defer bound.Close()
+	expect(events, EventReconnected)
+}
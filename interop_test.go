@@ -0,0 +1,347 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The interoperability tests run each protocol over all transports against
+// the nanomsg library, checking delivery, ordering, fairness and timeouts.
+
+// interopTimeout bounds the blocking operations of the tests, and
+// shortTimeout is used where an operation is expected to time out.
+const (
+	interopTimeout = 2 * time.Second
+	shortTimeout   = 20 * time.Millisecond
+)
+
+var transports = []struct {
+	name    string
+	address func(t *testing.T) string
+}{
+	{"inproc", func(t *testing.T) string {
+		return "inproc://" + t.Name()
+	}},
+	{"ipc", func(t *testing.T) string {
+		// t.TempDir is not used, as the test name could make the path
+		// longer than allowed for unix sockets.
+		dir, err := os.MkdirTemp("", "nanomsg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		return "ipc://" + filepath.Join(dir, "interop.ipc")
+	}},
+	{"tcp", func(t *testing.T) string {
+		return "tcp://127.0.0.1:0"
+	}},
+	{"ws", func(t *testing.T) string {
+		return "ws://127.0.0.1:0"
+	}},
+}
+
+// forEachTransport runs the test once for each transport with an address to
+// bind to.
+func forEachTransport(t *testing.T, test func(t *testing.T, address string)) {
+	for _, transport := range transports {
+		t.Run(transport.name, func(t *testing.T) {
+			test(t, transport.address(t))
+		})
+	}
+}
+
+// interopConn is implemented by Socket and the socket wrappers embedding it.
+type interopConn interface {
+	Conn
+	Bind(address string) (*Endpoint, error)
+	Connect(address string) (*Endpoint, error)
+	SetRecvTimeout(timeout time.Duration) error
+	WaitConnected(ctx context.Context, n int) error
+}
+
+// interopSocket creates a socket using the constructor of one of the socket
+// wrappers, e.g. NewPairSocket. The socket is closed when the test ends.
+func interopSocket[S interopConn](t *testing.T, newSocket func(...SocketOption) (S, error), opts ...SocketOption) S {
+	t.Helper()
+	opts = append([]SocketOption{WithSendTimeout(interopTimeout), WithRecvTimeout(interopTimeout)}, opts...)
+	s, err := newSocket(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// link binds the server to the address and connects the clients to it,
+// waiting for the connections to be established.
+func link(t *testing.T, address string, server interopConn, clients ...interopConn) {
+	t.Helper()
+	endpoint, err := server.Bind(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range clients {
+		if _, err = client.Connect(endpoint.Address); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// nanomsg does not keep connection statistics for inproc, where the
+	// sockets are connected right away.
+	if endpoint.Addr.Transport == "inproc" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), interopTimeout)
+	defer cancel()
+	if err = server.WaitConnected(ctx, len(clients)); err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range clients {
+		if err = client.WaitConnected(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func mustSend(t *testing.T, s Sender, msg string) {
+	t.Helper()
+	if _, err := s.Send([]byte(msg), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustRecv(t *testing.T, s Receiver) string {
+	t.Helper()
+	data, err := s.Recv(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func expectRecv(t *testing.T, s Receiver, expected string) {
+	t.Helper()
+	if msg := mustRecv(t, s); msg != expected {
+		t.Errorf("unexpected message: %q != %q", msg, expected)
+	}
+}
+
+// expectRecvTimeout checks that nothing is received on the socket.
+func expectRecvTimeout(t *testing.T, s interopConn) {
+	t.Helper()
+	if err := s.SetRecvTimeout(shortTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.Recv(0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected timeout, got %q, %v", data, err)
+	}
+}
+
+func TestInteropPair(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		a, b := interopSocket(t, NewPairSocket), interopSocket(t, NewPairSocket)
+		link(t, address, a, b)
+
+		for i := 0; i < 10; i++ {
+			mustSend(t, a, strconv.Itoa(i))
+		}
+		for i := 0; i < 10; i++ {
+			expectRecv(t, b, strconv.Itoa(i))
+		}
+		mustSend(t, b, "reply")
+		expectRecv(t, a, "reply")
+		expectRecvTimeout(t, a)
+	})
+}
+
+func TestInteropReqRep(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		req := interopSocket(t, NewReqSocket)
+		reps := []*RepSocket{interopSocket(t, NewRepSocket), interopSocket(t, NewRepSocket)}
+		link(t, address, req, reps[0], reps[1])
+
+		var wg sync.WaitGroup
+		for i, rep := range reps {
+			wg.Add(1)
+			go func(name string, rep *RepSocket) {
+				defer wg.Done()
+				for {
+					data, err := rep.Recv(0)
+					if err != nil {
+						return
+					}
+					if _, err = rep.Send(append(data, name...), 0); err != nil {
+						return
+					}
+				}
+			}(strconv.Itoa(i), rep)
+		}
+
+		// Requests are load balanced between the repliers, and each reply is
+		// matched with its request. nanomsg does not guarantee a strict
+		// round-robin split, only that every replier gets some of them.
+		const requests = 10
+		replies := make(map[string]int)
+		for i := 0; i < requests; i++ {
+			request := strconv.Itoa(i) + "-"
+			mustSend(t, req, request)
+			reply := mustRecv(t, req)
+			if len(reply) != len(request)+1 || reply[:len(request)] != request {
+				t.Fatalf("unexpected reply to %q: %q", request, reply)
+			}
+			replies[reply[len(request):]]++
+		}
+		total := 0
+		for i := range reps {
+			if replies[strconv.Itoa(i)] == 0 {
+				t.Errorf("no requests sent to replier %d: %v", i, replies)
+			}
+			total += replies[strconv.Itoa(i)]
+		}
+		if total != requests {
+			t.Errorf("unexpected replies: %v", replies)
+		}
+		for _, rep := range reps {
+			rep.Close()
+		}
+		wg.Wait()
+	})
+}
+
+func TestInteropReqTimeout(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		req, rep := interopSocket(t, NewReqSocket), interopSocket(t, NewRepSocket)
+		link(t, address, rep, req)
+
+		mustSend(t, req, "unanswered")
+		expectRecv(t, rep, "unanswered")
+		expectRecvTimeout(t, req)
+	})
+}
+
+func TestInteropPubSub(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		pub := interopSocket(t, NewPubSocket)
+		subA, subB := interopSocket(t, NewSubSocket), interopSocket(t, NewSubSocket)
+		if err := subA.Subscribe("a."); err != nil {
+			t.Fatal(err)
+		}
+		if err := subB.Subscribe("b."); err != nil {
+			t.Fatal(err)
+		}
+		link(t, address, pub, subA, subB)
+
+		for _, msg := range []string{"a.1", "b.1", "c.1", "a.2", "b.2"} {
+			mustSend(t, pub, msg)
+		}
+		expectRecv(t, subA, "a.1")
+		expectRecv(t, subA, "a.2")
+		expectRecv(t, subB, "b.1")
+		expectRecv(t, subB, "b.2")
+		expectRecvTimeout(t, subA)
+		expectRecvTimeout(t, subB)
+	})
+}
+
+func TestInteropPipeline(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		push := interopSocket(t, NewPushSocket)
+		pulls := []*PullSocket{interopSocket(t, NewPullSocket), interopSocket(t, NewPullSocket)}
+		link(t, address, push, pulls[0], pulls[1])
+
+		const messages = 10
+		for i := 0; i < messages; i++ {
+			mustSend(t, push, strconv.Itoa(i))
+		}
+		// Messages are load balanced between the pullers, and each puller
+		// receives its messages in order. Like for REQ, the split between
+		// the pullers is not exact.
+		total := 0
+		for i, pull := range pulls {
+			if err := pull.SetRecvTimeout(shortTimeout); err != nil {
+				t.Fatal(err)
+			}
+			last, received := -1, 0
+			for {
+				data, err := pull.Recv(0)
+				if errors.Is(err, ErrTimeout) {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				n, err := strconv.Atoi(string(data))
+				if err != nil {
+					t.Fatal(err)
+				} else if n <= last {
+					t.Errorf("message %d received after %d", n, last)
+				}
+				last = n
+				received++
+			}
+			if received == 0 {
+				t.Errorf("no messages sent to puller %d", i)
+			}
+			total += received
+		}
+		if total != messages {
+			t.Errorf("%d messages received, expected %d", total, messages)
+		}
+	})
+}
+
+func TestInteropPushTimeout(t *testing.T) {
+	push := interopSocket(t, NewPushSocket, WithSendTimeout(shortTimeout))
+	if _, err := push.Send([]byte("nobody listens"), 0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+}
+
+func TestInteropSurvey(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		surveyor := interopSocket(t, NewSurveyorSocket, WithDeadline(500*time.Millisecond))
+		respondents := []*RespondentSocket{interopSocket(t, NewRespondentSocket), interopSocket(t, NewRespondentSocket)}
+		link(t, address, surveyor, respondents[0], respondents[1])
+
+		mustSend(t, surveyor, "survey")
+		for i, respondent := range respondents {
+			expectRecv(t, respondent, "survey")
+			mustSend(t, respondent, strconv.Itoa(i))
+		}
+		responses := make(map[string]bool)
+		for range respondents {
+			responses[mustRecv(t, surveyor)] = true
+		}
+		if !responses["0"] || !responses["1"] {
+			t.Errorf("unexpected responses: %v", responses)
+		}
+		if _, err := surveyor.Recv(0); !errors.Is(err, ErrSurveyExpired) {
+			t.Errorf("expected survey to expire, got %v", err)
+		}
+	})
+}
+
+func TestInteropBus(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, address string) {
+		hub := interopSocket(t, NewBusSocket)
+		nodes := []*BusSocket{interopSocket(t, NewBusSocket), interopSocket(t, NewBusSocket)}
+		link(t, address, hub, nodes[0], nodes[1])
+
+		mustSend(t, hub, "from hub")
+		for _, node := range nodes {
+			expectRecv(t, node, "from hub")
+		}
+		expectRecvTimeout(t, hub)
+
+		// Messages are not forwarded, so the nodes only reach the hub.
+		mustSend(t, nodes[0], "from node")
+		expectRecv(t, hub, "from node")
+		expectRecvTimeout(t, nodes[1])
+	})
+}
@@ -0,0 +1,64 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"syscall"
+)
+
+// SetLogger sets the logger used to record what the socket is doing; binds,
+// connects, shutdowns, close, option changes and send and receive errors. Each
+// record carries the socket name and protocol. A nil logger, which is the
+// default, disables logging.
+func (s *Socket) SetLogger(logger *slog.Logger) {
+	s.logger.Store(logger)
+}
+
+// Logger returns the logger set using SetLogger.
+func (s *Socket) Logger() *slog.Logger {
+	return s.logger.Load()
+}
+
+func (s *Socket) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := s.logger.Load()
+	if logger == nil || !logger.Enabled(context.Background(), level) {
+		return
+	}
+	s.mu.Lock()
+	name := s.name
+	s.mu.Unlock()
+	attrs = append([]slog.Attr{
+		slog.String("socket", name),
+		slog.String("protocol", s.protocol.String()),
+	}, attrs...)
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// orDiscard returns logger, or a logger discarding all records if it is nil.
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return logger
+}
+
+// discardHandler drops all records.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// logError records a failed send or receive. Errors which are part of normal
+// operation, like timeouts, are recorded at debug level.
+func (s *Socket) logError(op string, err error) {
+	level := slog.LevelError
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ETIMEDOUT) {
+		level = slog.LevelDebug
+	}
+	s.log(level, "nanomsg: "+op+" failed", slog.Any("error", err))
+}
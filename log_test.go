@@ -0,0 +1,48 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	s.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if err = s.SetName("log-sock"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Bind("inproc://log"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Recv(DontWait); err == nil {
+		t.Fatal("expected failure")
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		`msg="nanomsg: set option" socket=log-sock protocol=PAIR option=NN_SOCKET_NAME value=log-sock`,
+		`msg="nanomsg: bound endpoint" socket=log-sock protocol=PAIR address=inproc://log`,
+		`msg="nanomsg: recv failed" socket=log-sock protocol=PAIR error=`,
+		`msg="nanomsg: closed socket" socket=log-sock protocol=PAIR`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected log:\n%s", buf.String())
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, expected[i]) {
+			t.Errorf("unexpected log line: %s", line)
+		}
+	}
+}
@@ -9,8 +9,14 @@ import "C"
 
 import (
 	"errors"
+	"log/slog"
+	"net"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -29,33 +35,127 @@ const (
 
 type Protocol int
 
+func (p Protocol) String() string {
+	if name, exists := symbolName(C.NN_NS_PROTOCOL, int(p)); exists {
+		return strings.TrimPrefix(name, "NN_")
+	}
+	return "Protocol(" + strconv.Itoa(int(p)) + ")"
+}
+
 // Sending and receiving can be controlled with these flags.
 const (
 	// Specifies that the operation should be performed in non-blocking mode.
 	// If the message cannot be received or sent straight away, the function
-	// will fail with error EAGAIN.
+	// will fail with error EAGAIN, which matches ErrWouldBlock.
 	DontWait = int(C.NN_DONTWAIT)
 )
 
 type Socket struct {
-	// socket is the actual nanomsg C API object
-	socket C.int
-}
-
-// Create a socket.
-func NewSocket(domain Domain, protocol Protocol) (*Socket, error) {
+	// socket is the actual nanomsg C API object. It is set to -1 when the
+	// socket is closed, as nanomsg reuses the integer for new sockets. Calls
+	// into nanomsg hold calls for reading while using the integer.
+	socket   atomic.Int32
+	calls    sync.RWMutex
+	protocol Protocol
+	logger   atomic.Pointer[slog.Logger]
+
+	// endpoints holds the endpoints added to the socket, in the order they
+	// were added. They are stored without a reference back to the socket to
+	// not prevent the finalizer from running.
+	mu        sync.Mutex
+	endpoints []Endpoint
+
+	// name is the socket name, kept for logging.
+	name string
+
+	// topicDelimiter is set by SetTopicDelimiter on PUB and SUB sockets.
+	topicDelimiter string
+
+	// events, stopEvents and eventsDone are used by the background polling
+	// started by Events.
+	events     chan Event
+	stopEvents chan struct{}
+	eventsDone chan struct{}
+
+	// closing is set by CloseGracefully to stop accepting new sends, and
+	// sending is the number of sends in progress.
+	closing atomic.Bool
+	sending atomic.Int64
+
+	// subscriptions is set on SUB sockets once patterns are used.
+	subscriptions atomic.Pointer[subscriptions]
+}
+
+// Create a socket. The given options are applied before the socket is
+// returned. If any of them fails, the socket is closed and an *OptionError
+// describing the failing option is returned.
+func NewSocket(domain Domain, protocol Protocol, opts ...SocketOption) (*Socket, error) {
+	socketReuse.Lock()
 	rc, err := C.nn_socket(C.int(domain), C.int(protocol))
+	socketReuse.Unlock()
 	if rc == -1 {
-		return nil, nnError(err)
+		return nil, &OpError{Op: "socket", Protocol: protocol, Err: nnError(err)}
 	}
 
 	// Create the socket object and make sure we call Close before freeing up the
-	// memory inside the Go runtime.
-	socket := &Socket{socket: rc}
+	// memory inside the Go runtime. nanomsg names sockets after their integer
+	// until SetName is called.
+	socket := &Socket{protocol: protocol, name: strconv.Itoa(int(rc))}
+	socket.socket.Store(int32(rc))
 	socket.setFinalizer()
+
+	if len(opts) > 0 {
+		var o SocketOptions
+		for _, opt := range opts {
+			opt(&o)
+		}
+		if err = socket.applyOptions(o); err != nil {
+			socket.Close()
+			return nil, err
+		}
+	}
 	return socket, nil
 }
 
+// socketReuse keeps nanomsg from handing out the integer of a closed socket
+// to a new socket while calls which loaded the integer before the socket was
+// closed are still in flight. Such calls would otherwise end up operating on
+// the new socket. Close holds it for reading until those calls have returned,
+// and NewSocket holds it for writing while creating the socket.
+var socketReuse sync.RWMutex
+
+// hold returns the nanomsg socket for a call into the library, or ErrClosed if
+// the socket has been closed. Unless an error is returned, release must be
+// called once the call has returned.
+func (s *Socket) hold() (C.int, error) {
+	s.calls.RLock()
+	if fd := s.socket.Load(); fd >= 0 {
+		return C.int(fd), nil
+	}
+	s.calls.RUnlock()
+	return -1, ErrClosed
+}
+
+// release releases the socket held by hold.
+func (s *Socket) release() {
+	s.calls.RUnlock()
+}
+
+// closed returns true if the socket has been closed.
+func (s *Socket) closed() bool {
+	return s.socket.Load() < 0
+}
+
+// callError converts the error of a failed call into the library. Calls in
+// flight when the socket is closed fail with EBADF, which is reported as
+// ErrClosed.
+func (s *Socket) callError(err error) error {
+	if err = nnError(err); err == syscall.EBADF && s.closed() {
+		return ErrClosed
+	}
+	return err
+}
+
 func (s *Socket) setFinalizer() {
 	runtime.SetFinalizer(s, (*Socket).Close)
 }
@@ -64,29 +164,52 @@ func (s *Socket) setFinalizer() {
 // received by the application will be discarded. The library will try to
 // deliver any outstanding outbound messages for the time specified by the
 // linger socket option. The call will block in the meantime.
+//
+// Once closed, all operations on the socket return an error matching
+// ErrClosed. Calling Close again, or concurrently, does nothing.
 func (s *Socket) Close() error {
-	if rc, err := C.nn_close(s.socket); rc != 0 {
+	// The statistics polled for events are read from the socket, so polling
+	// is stopped before the socket is closed.
+	s.stopEventPolling()
+	fd := s.socket.Swap(-1)
+	if fd < 0 {
+		return nil
+	}
+	socketReuse.RLock()
+	rc, err := C.nn_close(C.int(fd))
+	if rc == 0 {
+		// nn_close wakes up the calls blocked in nanomsg, and calls which
+		// have yet to enter nanomsg fail as the socket no longer exists.
+		// Wait for all of them before the integer can be reused.
+		s.calls.Lock()
+		s.calls.Unlock()
+	}
+	socketReuse.RUnlock()
+	if rc != 0 {
 		// If the close call was interrupted by the signal handler, nanomsg
 		// would return EINTR. All is good except when Close() is called by the
 		// Go runtime during garbage collection. When this happens, the Go
 		// runtime clears the finalizer before running it. Hence we need to set
 		// it again to avoid leaking resources.
 		//
-		// This has a couple of side-effects that might not be obvious.
-		//
-		// * If the user calls Close() two times, and the latter one is
-		//   interrupted we will queue yet another call to Close. (Most likely
-		//   the second call to nn_close will not block.)
-		//
-		// * If the user has set a custom finalizer, we would at this point
-		//   override it.
-		//
-		// However, all of these scenarios is an unexpected use of this library.
+		// The socket is still open in this case, so it is restored for
+		// Close to be called again. Note that if the user has set a custom
+		// finalizer, we would at this point override it. However, this is an
+		// unexpected use of this library.
 		if err = nnError(err); err == syscall.EINTR {
+			s.socket.Store(fd)
 			s.setFinalizer()
 		}
+		err = s.opError("close", "", err)
+		s.log(slog.LevelError, "nanomsg: close failed", slog.Any("error", err))
 		return err
 	}
+	s.log(slog.LevelInfo, "nanomsg: closed socket")
+	// Closing the socket shuts down all of its endpoints.
+	s.mu.Lock()
+	s.endpoints = nil
+	s.mu.Unlock()
+
 	// Once the socket has been closed, we no longer need to call Close when the
 	// object is garbage collected.
 	runtime.SetFinalizer(s, nil)
@@ -101,35 +224,183 @@ func (s *Socket) Close() error {
 // protocol to use. The meaning of the 'address' part is specific to the
 // underlying transport protocol.
 //
+// The address is validated before it is handed to nanomsg, and an *AddrError is
+// returned if it is malformed. See Addr for the supported formats.
+//
+// nanomsg does not allow binding tcp and ws endpoints to port 0. To still
+// support ephemeral ports, a free port is picked by asking the operating
+// system for one before binding to it. The address of the returned endpoint
+// holds the port which was actually bound.
+//
 // Endpoint is returned and can be used to unbind.
 func (s *Socket) Bind(address string) (*Endpoint, error) {
+	endpoint, err := s.bindAddress(address)
+	if err != nil {
+		err = s.opError("bind", address, err)
+		s.log(slog.LevelError, "nanomsg: bind failed", slog.String("address", address), slog.Any("error", err))
+		return nil, err
+	}
+	s.log(slog.LevelInfo, "nanomsg: bound endpoint", slog.String("address", endpoint.Address))
+	return endpoint, nil
+}
+
+func (s *Socket) bindAddress(address string) (*Endpoint, error) {
+	addr, err := ParseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.Iface != "" {
+		return nil, &AddrError{address, "interface is only used when connecting", syscall.EINVAL}
+	}
+	if (addr.Transport == "tcp" || addr.Transport == "ws") && addr.Port == 0 {
+		return s.bindEphemeral(addr)
+	}
+	eid, err := s.bind(address)
+	if err != nil {
+		return nil, err
+	}
+	return s.addEndpoint(Endpoint{Address: address, Addr: addr, endpoint: eid, bound: true}), nil
+}
+
+// ephemeralAttempts is the number of ports tried before giving up binding to
+// an ephemeral port.
+const ephemeralAttempts = 16
+
+// bindEphemeral binds to a port picked by the operating system. As the port is
+// released before nanomsg binds to it, some other process may grab it in the
+// meantime. If so, another port is tried.
+func (s *Socket) bindEphemeral(addr *Addr) (*Endpoint, error) {
+	host := ""
+	if ip := net.ParseIP(addr.Host); ip != nil {
+		host = addr.Host
+	}
+	var err error
+	for i := 0; i < ephemeralAttempts; i++ {
+		var port int
+		if port, err = freePort(host); err != nil {
+			return nil, err
+		}
+		bound := *addr
+		bound.Port = port
+		address := bound.String()
+
+		var eid C.int
+		if eid, err = s.bind(address); err == nil {
+			return s.addEndpoint(Endpoint{Address: address, Addr: &bound, endpoint: eid, bound: true}), nil
+		} else if err != syscall.EADDRINUSE {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// freePort returns a tcp port which currently is not in use on host.
+func freePort(host string) (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (s *Socket) bind(address string) (C.int, error) {
+	fd, err := s.hold()
+	if err != nil {
+		return -1, err
+	}
+	defer s.release()
 	cstr := C.CString(address)
 	defer C.free(unsafe.Pointer(cstr))
-	eid, err := C.nn_bind(s.socket, cstr)
+	eid, err := C.nn_bind(fd, cstr)
 	if eid < 0 {
-		return nil, nnError(err)
+		return eid, s.callError(err)
 	}
-	return &Endpoint{address, eid}, nil
+	return eid, nil
 }
 
-// Add a remote endpoint to the socket.
+// Add a remote endpoint to the socket. The address is validated the same way
+// as for Bind.
 func (s *Socket) Connect(address string) (*Endpoint, error) {
+	endpoint, err := s.connectAddress(address)
+	if err != nil {
+		err = s.opError("connect", address, err)
+		s.log(slog.LevelError, "nanomsg: connect failed", slog.String("address", address), slog.Any("error", err))
+		return nil, err
+	}
+	s.log(slog.LevelInfo, "nanomsg: connected endpoint", slog.String("address", address))
+	return endpoint, nil
+}
+
+func (s *Socket) connectAddress(address string) (*Endpoint, error) {
+	addr, err := ParseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	if (addr.Transport == "tcp" || addr.Transport == "ws") && addr.Port == 0 {
+		return nil, &AddrError{address, "port 0 is only valid when binding", syscall.EINVAL}
+	}
+	fd, err := s.hold()
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
 	cstr := C.CString(address)
 	defer C.free(unsafe.Pointer(cstr))
-	eid, err := C.nn_connect(s.socket, cstr)
+	eid, err := C.nn_connect(fd, cstr)
 	if eid < 0 {
-		return nil, nnError(err)
+		return nil, s.callError(err)
+	}
+	return s.addEndpoint(Endpoint{Address: address, Addr: addr, endpoint: eid}), nil
+}
+
+func (s *Socket) addEndpoint(endpoint Endpoint) *Endpoint {
+	s.mu.Lock()
+	s.endpoints = append(s.endpoints, endpoint)
+	s.mu.Unlock()
+	endpoint.socket = s
+	return &endpoint
+}
+
+// Endpoints returns the endpoints currently added to the socket, in the order
+// they were added.
+func (s *Socket) Endpoints() []*Endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoints := make([]*Endpoint, len(s.endpoints))
+	for i := range s.endpoints {
+		endpoint := s.endpoints[i]
+		endpoint.socket = s
+		endpoints[i] = &endpoint
 	}
-	return &Endpoint{address, eid}, nil
+	return endpoints
 }
 
 // Removes an endpoint from the socket. This call will return immediately,
 // however, the library will try to deliver any outstanding outbound messages
 // to the endpoint for the time specified by the linger socket option.
 func (s *Socket) Shutdown(endpoint *Endpoint) error {
-	if rc, err := C.nn_shutdown(s.socket, endpoint.endpoint); rc != 0 {
-		return nnError(err)
+	fd, err := s.hold()
+	if err == nil {
+		if rc, errno := C.nn_shutdown(fd, endpoint.endpoint); rc != 0 {
+			err = s.callError(errno)
+		}
+		s.release()
 	}
+	if err != nil {
+		err = s.opError("shutdown", endpoint.Address, err)
+		s.log(slog.LevelError, "nanomsg: shutdown failed", slog.String("address", endpoint.Address), slog.Any("error", err))
+		return err
+	}
+	s.log(slog.LevelInfo, "nanomsg: shut down endpoint", slog.String("address", endpoint.Address))
+	s.mu.Lock()
+	for i := range s.endpoints {
+		if s.endpoints[i].endpoint == endpoint.endpoint {
+			s.endpoints = append(s.endpoints[:i], s.endpoints[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
 	return nil
 }
 
@@ -140,10 +411,23 @@ func (s *Socket) Send(data []byte, flags int) (int, error) {
 	if len(data) != 0 {
 		buf = unsafe.Pointer(&data[0])
 	}
+	s.sending.Add(1)
+	defer s.sending.Add(-1)
+	fd, err := s.hold()
+	if err == nil && s.closing.Load() {
+		s.release()
+		err = ErrClosed
+	}
+	if err != nil {
+		return -1, s.opError("send", "", err)
+	}
 	length := C.size_t(len(data))
-	size, err := C.nn_send(s.socket, buf, length, C.int(flags))
+	size, err := C.nn_send(fd, buf, length, C.int(flags))
+	s.release()
 	if size < 0 {
-		return int(size), nnError(err)
+		err = s.opError("send", "", s.callError(err))
+		s.logError("send", err)
+		return int(size), err
 	}
 	return int(size), nil
 }
@@ -155,8 +439,15 @@ func (s *Socket) Recv(flags int) ([]byte, error) {
 	var buf unsafe.Pointer
 	var length C.int
 
-	if length, err = C.nn_recv(s.socket, unsafe.Pointer(&buf), nn_msg, C.int(flags)); length < 0 {
-		return nil, nnError(err)
+	fd, err := s.hold()
+	if err != nil {
+		return nil, s.opError("recv", "", err)
+	}
+	defer s.release()
+	if length, err = C.nn_recv(fd, unsafe.Pointer(&buf), nn_msg, C.int(flags)); length < 0 {
+		err = s.opError("recv", "", s.callError(err))
+		s.logError("recv", err)
+		return nil, err
 	}
 
 	// TODO why is the latter variant faster than the zero copy variant?
@@ -174,7 +465,7 @@ func (s *Socket) Recv(flags int) ([]byte, error) {
 	} else {
 		data := C.GoBytes(buf, length)
 		if rc, err := C.nn_freemsg(buf); rc != 0 {
-			return data, nnError(err)
+			return data, s.opError("recv", "", nnError(err))
 		}
 		return data, nil
 	}
@@ -191,10 +482,14 @@ func finalizeMsg(datap *[]byte) error {
 func (s *Socket) SockOptInt(level, option C.int) (int, error) {
 	var value C.int
 	length := C.size_t(unsafe.Sizeof(value))
-	rc, err := C.nn_getsockopt(s.socket, level, option, unsafe.Pointer(&value), &length)
+	fd, err := s.hold()
+	if err != nil {
+		return 0, s.optionError("getsockopt", level, option, err)
+	}
+	defer s.release()
+	rc, err := C.nn_getsockopt(fd, level, option, unsafe.Pointer(&value), &length)
 	if rc != 0 {
-		err = nnError(err)
-		return int(value), err
+		return int(value), s.optionError("getsockopt", level, option, s.callError(err))
 	}
 	return int(value), nil
 }
@@ -202,10 +497,18 @@ func (s *Socket) SockOptInt(level, option C.int) (int, error) {
 func (s *Socket) SetSockOptInt(level, option C.int, value int) error {
 	val := C.int(value)
 	length := C.size_t(unsafe.Sizeof(val))
-	rc, err := C.nn_setsockopt(s.socket, level, option, unsafe.Pointer(&val), length)
+	fd, err := s.hold()
+	if err != nil {
+		return s.optionError("setsockopt", level, option, err)
+	}
+	defer s.release()
+	rc, err := C.nn_setsockopt(fd, level, option, unsafe.Pointer(&val), length)
 	if rc != 0 {
-		return nnError(err)
+		err = s.optionError("setsockopt", level, option, s.callError(err))
+		s.log(slog.LevelError, "nanomsg: set option failed", slog.String("option", optionSymbol(level, option)), slog.Int("value", value), slog.Any("error", err))
+		return err
 	}
+	s.log(slog.LevelDebug, "nanomsg: set option", slog.String("option", optionSymbol(level, option)), slog.Int("value", value))
 	return nil
 }
 
@@ -237,6 +540,11 @@ func (s *Socket) SetSockOptDuration(level, option C.int, unit, value time.Durati
 
 // SockOptString returns the value of the option as string.
 func (s *Socket) SockOptString(level, option C.int, maxSize int) (string, error) {
+	fd, err := s.hold()
+	if err != nil {
+		return "", s.optionError("getsockopt", level, option, err)
+	}
+	defer s.release()
 	size := C.size_t(maxSize) + 1
 	cval := (*C.char)(C.malloc(size))
 	if cval == nil {
@@ -244,10 +552,9 @@ func (s *Socket) SockOptString(level, option C.int, maxSize int) (string, error)
 	}
 	defer C.free(unsafe.Pointer(cval))
 
-	rc, err := C.nn_getsockopt(s.socket, level, option, unsafe.Pointer(cval), &size)
+	rc, err := C.nn_getsockopt(fd, level, option, unsafe.Pointer(cval), &size)
 	if rc != 0 {
-		err = nnError(err)
-		return "", err
+		return "", s.optionError("getsockopt", level, option, s.callError(err))
 	}
 
 	value := C.GoStringN(cval, C.int(size))
@@ -256,13 +563,26 @@ func (s *Socket) SockOptString(level, option C.int, maxSize int) (string, error)
 
 // SetSockOptString sets the value of the option.
 func (s *Socket) SetSockOptString(level, option C.int, value string) error {
+	fd, err := s.hold()
+	if err != nil {
+		return s.optionError("setsockopt", level, option, err)
+	}
+	defer s.release()
 	cstr := C.CString(value)
 	defer C.free(unsafe.Pointer(cstr))
 	length := C.size_t(len(value))
-	rc, err := C.nn_setsockopt(s.socket, level, option, unsafe.Pointer(cstr), length)
+	rc, err := C.nn_setsockopt(fd, level, option, unsafe.Pointer(cstr), length)
 	if rc != 0 {
-		return nnError(err)
+		err = s.optionError("setsockopt", level, option, s.callError(err))
+		s.log(slog.LevelError, "nanomsg: set option failed", slog.String("option", optionSymbol(level, option)), slog.String("value", value), slog.Any("error", err))
+		return err
+	}
+	if level == C.NN_SOL_SOCKET && option == C.NN_SOCKET_NAME {
+		s.mu.Lock()
+		s.name = value
+		s.mu.Unlock()
 	}
+	s.log(slog.LevelDebug, "nanomsg: set option", slog.String("option", optionSymbol(level, option)), slog.String("value", value))
 	return nil
 }
 
@@ -327,7 +647,7 @@ func (s *Socket) SetRecvMaxSize(size int64) error {
 
 // SendTimeout returns the timeout for send operation on the socket.
 // If message cannot be sent within the specified timeout, ETIMEDOUT
-// error is returned. Negative value means infinite timeout. Default
+// error, which matches ErrTimeout, is returned. Negative value means infinite timeout. Default
 // value is infinite.
 func (s *Socket) SendTimeout() (time.Duration, error) {
 	return s.SockOptDuration(C.NN_SOL_SOCKET, C.NN_SNDTIMEO, time.Millisecond)
@@ -340,7 +660,7 @@ func (s *Socket) SetSendTimeout(timeout time.Duration) error {
 
 // RecvTimeout returns the timeout for recv operation on the
 // socket. If message cannot be received within the specified timeout,
-// EAGAIN error is returned. Negative value means infinite timeout.
+// ETIMEDOUT error, which matches ErrTimeout, is returned. Negative value means infinite timeout.
 // Default value is infinite.
 func (s *Socket) RecvTimeout() (time.Duration, error) {
 	return s.SockOptDuration(C.NN_SOL_SOCKET, C.NN_RCVTIMEO, time.Millisecond)
@@ -456,9 +776,36 @@ func (s *Socket) SetName(name string) error {
 	return s.SetSockOptString(C.NN_SOL_SOCKET, C.NN_SOCKET_NAME, name)
 }
 
+// Endpoint is a local or remote endpoint added to a socket using Bind or
+// Connect.
 type Endpoint struct {
-	Address  string
+	Address string
+	// Addr is the parsed form of Address.
+	Addr     *Addr
 	endpoint C.int
+	bound    bool
+	socket   *Socket
+}
+
+// Socket returns the socket the endpoint was added to.
+func (e *Endpoint) Socket() *Socket {
+	return e.socket
+}
+
+// Bound returns true if the endpoint was added using Bind, and false if it was
+// added using Connect.
+func (e *Endpoint) Bound() bool {
+	return e.bound
+}
+
+// Shutdown removes the endpoint from its socket. See Socket.Shutdown. An
+// endpoint which was not returned by Bind or Connect has no socket, and
+// EINVAL is returned.
+func (e *Endpoint) Shutdown() error {
+	if e.socket == nil {
+		return &OpError{Op: "shutdown", Addr: e.Address, Err: syscall.EINVAL}
+	}
+	return e.socket.Shutdown(e)
 }
 
 func (e *Endpoint) String() string {
@@ -4,6 +4,8 @@ package nanomsg
 
 import (
 	"bytes"
+	"errors"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -80,6 +82,55 @@ func TestGetSetOpt(t *testing.T) {
 	}
 }
 
+func TestEndpoints(t *testing.T) {
+	s, err := NewSocket(AF_SP, PAIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bound, err := s.Bind("inproc://endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connected, err := s.Connect("inproc://endpoints-peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bound.Bound() || connected.Bound() {
+		t.Error("unexpected bound flags")
+	}
+	if bound.Socket() != s || connected.Socket() != s {
+		t.Error("unexpected socket")
+	}
+
+	endpoints := s.Endpoints()
+	if len(endpoints) != 2 {
+		t.Fatalf("unexpected endpoints: %v", endpoints)
+	}
+	if endpoints[0].Address != "inproc://endpoints" || !endpoints[0].Bound() {
+		t.Errorf("unexpected endpoint: %v", endpoints[0])
+	}
+
+	if err = bound.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints = s.Endpoints(); len(endpoints) != 1 || endpoints[0].Address != "inproc://endpoints-peer" {
+		t.Errorf("unexpected endpoints: %v", endpoints)
+	}
+
+	var zero Endpoint
+	if err = zero.Shutdown(); !errors.Is(err, syscall.EINVAL) || errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints = s.Endpoints(); len(endpoints) != 0 {
+		t.Errorf("unexpected endpoints: %v", endpoints)
+	}
+}
+
 func BenchmarkInprocThroughput(b *testing.B) {
 	b.StopTimer()
 
@@ -0,0 +1,590 @@
+// Package nanomsgtest provides in-memory sockets for testing code which uses
+// nanomsg, without needing the nanomsg library.
+//
+// The sockets implement the Sender, Receiver and Conn interfaces of the sp
+// package, which the nanomsg package exposes under the same names, and follow
+// the semantics of the nanomsg protocols closely enough for unit tests.
+// Neither package imports the nanomsg package, so code written against the
+// interfaces can be tested without cgo.
+//
+// Errors are returned as *OpError, wrapping the same syscall errors as the
+// nanomsg package. Like the errors of the nanomsg package, they match the
+// errors of the sp package using errors.Is, e.g. sp.ErrTimeout or
+// sp.ErrWouldBlock.
+package nanomsgtest
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/op/go-nanomsg/sp"
+)
+
+// Protocol is the protocol of a socket.
+type Protocol int
+
+const (
+	PAIR Protocol = iota + 1
+	PUB
+	SUB
+	REQ
+	REP
+	PUSH
+	PULL
+	SURVEYOR
+	RESPONDENT
+	BUS
+)
+
+var protocolNames = map[Protocol]string{
+	PAIR:       "PAIR",
+	PUB:        "PUB",
+	SUB:        "SUB",
+	REQ:        "REQ",
+	REP:        "REP",
+	PUSH:       "PUSH",
+	PULL:       "PULL",
+	SURVEYOR:   "SURVEYOR",
+	RESPONDENT: "RESPONDENT",
+	BUS:        "BUS",
+}
+
+func (p Protocol) String() string {
+	if name, exists := protocolNames[p]; exists {
+		return name
+	}
+	return "Protocol(" + strconv.Itoa(int(p)) + ")"
+}
+
+// peer returns the protocol a socket of this protocol can be connected to.
+func (p Protocol) peer() Protocol {
+	switch p {
+	case PUB:
+		return SUB
+	case SUB:
+		return PUB
+	case REQ:
+		return REP
+	case REP:
+		return REQ
+	case PUSH:
+		return PULL
+	case PULL:
+		return PUSH
+	case SURVEYOR:
+		return RESPONDENT
+	case RESPONDENT:
+		return SURVEYOR
+	}
+	return p
+}
+
+// DontWait makes Send and Recv fail with EAGAIN instead of blocking. It has
+// the same value as nanomsg.DontWait.
+const DontWait = sp.DontWait
+
+// DefaultDeadline is the survey deadline of new SURVEYOR sockets, the same as
+// used by nanomsg.
+const DefaultDeadline = time.Second
+
+// ErrState is returned when the operation is not valid in the current state
+// of the socket, e.g. receiving on a REQ socket before sending a request.
+// It is the EFSM error returned by nanomsg in this case.
+const ErrState = sp.EFSM
+
+// OpError is the error type returned by operations on sockets. Like the
+// errors of the nanomsg package, it matches sp.ErrTimeout, sp.ErrWouldBlock,
+// sp.ErrSurveyExpired and sp.ErrClosed using errors.Is.
+type OpError struct {
+	// Op is the operation which failed, e.g. "send" or "setsockopt".
+	Op       string
+	Protocol Protocol
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	return "nanomsgtest: " + e.Op + " (" + e.Protocol.String() + " socket): " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is match the error with the errors of the sp package.
+func (e *OpError) Is(target error) bool {
+	if target == sp.ErrSurveyExpired {
+		return e.Op == "recv" && e.Protocol == SURVEYOR && errors.Is(e.Err, syscall.ETIMEDOUT)
+	}
+	return sp.MatchErrno(e.Err, target)
+}
+
+// Network connects in-memory sockets. Addresses are plain strings, and are
+// only visible to the sockets of the same network.
+type Network struct {
+	mu         sync.Mutex
+	bound      map[string]*Socket
+	connecting map[string][]*Socket
+}
+
+// NewNetwork creates an empty network.
+func NewNetwork() *Network {
+	return &Network{
+		bound:      make(map[string]*Socket),
+		connecting: make(map[string][]*Socket),
+	}
+}
+
+var defaultNetwork = NewNetwork()
+
+// NewSocket creates a socket on a network shared by the whole process, like
+// the inproc transport of nanomsg.
+func NewSocket(protocol Protocol) *Socket {
+	return defaultNetwork.NewSocket(protocol)
+}
+
+// NewSocket creates a socket on the network.
+func (n *Network) NewSocket(protocol Protocol) *Socket {
+	return &Socket{
+		network:     n,
+		protocol:    protocol,
+		wake:        make(chan struct{}),
+		sendTimeout: -1,
+		recvTimeout: -1,
+		deadline:    DefaultDeadline,
+	}
+}
+
+// message is a message queued on a socket. from and id are used to route
+// replies and match them with requests and surveys.
+type message struct {
+	data []byte
+	from *Socket
+	id   uint32
+}
+
+// Socket is an in-memory socket. Inbound messages are queued without limit, so
+// sends only block when there is no peer to send to.
+type Socket struct {
+	network  *Network
+	protocol Protocol
+
+	mu     sync.Mutex
+	closed bool
+	peers  []*Socket
+	next   int
+	queue  []message
+	// wake is closed and replaced whenever the state of the socket changes,
+	// to wake up blocked sends and receives.
+	wake chan struct{}
+
+	sendTimeout, recvTimeout, deadline time.Duration
+	subscriptions                      []string
+
+	// id is the request or survey in progress on REQ and SURVEYOR sockets,
+	// and surveyEnd is when the survey expires.
+	lastID, id uint32
+	surveyEnd  time.Time
+	// replyTo and replyID are the peer and id to send the reply to on REP
+	// and RESPONDENT sockets.
+	replyTo *Socket
+	replyID uint32
+
+	addresses []string
+}
+
+// Protocol returns the protocol of the socket.
+func (s *Socket) Protocol() Protocol {
+	return s.protocol
+}
+
+func (s *Socket) error(op string, err error) error {
+	return &OpError{Op: op, Protocol: s.protocol, Err: err}
+}
+
+// broadcast wakes up blocked sends and receives. It is called with the lock
+// held.
+func (s *Socket) broadcast() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// wait blocks until wake is closed, or returns ETIMEDOUT if the deadline is
+// reached first. A zero deadline waits forever. It is called without the lock
+// held.
+func wait(wake <-chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-wake
+		return nil
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-wake:
+		return nil
+	case <-timer.C:
+		return syscall.ETIMEDOUT
+	}
+}
+
+// timeoutDeadline returns the deadline for a timeout, where a negative
+// timeout is infinite.
+func timeoutDeadline(timeout time.Duration) time.Time {
+	if timeout < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// Bind makes the socket available for other sockets to connect to at the
+// address.
+func (s *Socket) Bind(address string) error {
+	n := s.network
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if s.isClosed() {
+		return s.error("bind", syscall.EBADF)
+	}
+	if _, exists := n.bound[address]; exists {
+		return s.error("bind", syscall.EADDRINUSE)
+	}
+	n.bound[address] = s
+	s.mu.Lock()
+	s.addresses = append(s.addresses, address)
+	s.mu.Unlock()
+	for _, peer := range n.connecting[address] {
+		attach(s, peer)
+	}
+	return nil
+}
+
+// Connect connects the socket to the address. Like with nanomsg, the address
+// does not have to be bound yet, and the socket is connected once it is.
+func (s *Socket) Connect(address string) error {
+	n := s.network
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if s.isClosed() {
+		return s.error("connect", syscall.EBADF)
+	}
+	n.connecting[address] = append(n.connecting[address], s)
+	s.mu.Lock()
+	s.addresses = append(s.addresses, address)
+	s.mu.Unlock()
+	if peer, exists := n.bound[address]; exists {
+		attach(peer, s)
+	}
+	return nil
+}
+
+// attach connects two sockets if their protocols match, and both accept
+// another peer. It is called with the network lock held.
+func attach(a, b *Socket) {
+	if a.protocol.peer() != b.protocol || !a.acceptsPeer() || !b.acceptsPeer() {
+		return
+	}
+	a.addPeer(b)
+	b.addPeer(a)
+}
+
+// acceptsPeer returns false if the socket is closed, or if it is a PAIR socket
+// which is already connected, as PAIR sockets only have one peer.
+func (s *Socket) acceptsPeer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.closed && (s.protocol != PAIR || len(s.peers) == 0)
+}
+
+func (s *Socket) addPeer(peer *Socket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers = append(s.peers, peer)
+	s.broadcast()
+}
+
+// reattach connects a PAIR socket which lost its peer to another socket on
+// one of its addresses, if there is one. It is called with the network lock
+// held.
+func (n *Network) reattach(s *Socket) {
+	s.mu.Lock()
+	addresses := append([]string(nil), s.addresses...)
+	s.mu.Unlock()
+	for _, address := range addresses {
+		if n.bound[address] == s {
+			for _, peer := range n.connecting[address] {
+				attach(s, peer)
+			}
+		} else if peer, exists := n.bound[address]; exists {
+			attach(peer, s)
+		}
+	}
+}
+
+func (s *Socket) removePeer(peer *Socket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.peers {
+		if p == peer {
+			s.peers = append(s.peers[:i], s.peers[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Socket) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Close closes the socket. Blocked sends and receives fail with EBADF, as do
+// any further operations.
+func (s *Socket) Close() error {
+	n := s.network
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	peers, addresses := s.peers, s.addresses
+	s.peers, s.queue = nil, nil
+	s.broadcast()
+	s.mu.Unlock()
+
+	for _, address := range addresses {
+		if n.bound[address] == s {
+			delete(n.bound, address)
+		}
+		connecting := n.connecting[address]
+		for i, c := range connecting {
+			if c == s {
+				n.connecting[address] = append(connecting[:i], connecting[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, peer := range peers {
+		peer.removePeer(s)
+		if peer.protocol == PAIR {
+			n.reattach(peer)
+		}
+	}
+	return nil
+}
+
+// deliver queues the message on the socket, unless a SUB socket is not
+// subscribed to it.
+func (s *Socket) deliver(msg message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || (s.protocol == SUB && !s.subscribed(msg.data)) {
+		return
+	}
+	s.queue = append(s.queue, msg)
+	s.broadcast()
+}
+
+func (s *Socket) subscribed(data []byte) bool {
+	for _, topic := range s.subscriptions {
+		if len(data) >= len(topic) && string(data[:len(topic)]) == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Send sends a message containing the data. The flags argument can be zero or
+// DontWait.
+func (s *Socket) Send(data []byte, flags int) (int, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return -1, s.error("send", syscall.EBADF)
+	}
+	msg := message{data: append([]byte(nil), data...), from: s}
+
+	var peers []*Socket
+	switch s.protocol {
+	case SUB, PULL:
+		s.mu.Unlock()
+		return -1, s.error("send", syscall.ENOTSUP)
+	case PUB, BUS:
+		peers = append(peers, s.peers...)
+	case SURVEYOR:
+		s.lastID++
+		s.id, msg.id = s.lastID, s.lastID
+		s.surveyEnd = time.Now().Add(s.deadline)
+		peers = append(peers, s.peers...)
+	case REP, RESPONDENT:
+		if s.replyTo == nil {
+			s.mu.Unlock()
+			return -1, s.error("send", ErrState)
+		}
+		peers = []*Socket{s.replyTo}
+		msg.id = s.replyID
+		s.replyTo = nil
+	default:
+		peer, err := s.nextPeer(flags)
+		if err != nil {
+			s.mu.Unlock()
+			return -1, s.error("send", err)
+		}
+		if s.protocol == REQ {
+			s.lastID++
+			s.id, msg.id = s.lastID, s.lastID
+		}
+		peers = []*Socket{peer}
+	}
+	s.mu.Unlock()
+
+	for _, peer := range peers {
+		peer.deliver(msg)
+	}
+	return len(data), nil
+}
+
+// nextPeer picks the peer to send to in round-robin order, waiting for a
+// peer to connect if there is none. It is called with the lock held.
+func (s *Socket) nextPeer(flags int) (*Socket, error) {
+	deadline := timeoutDeadline(s.sendTimeout)
+	for len(s.peers) == 0 {
+		if flags&DontWait != 0 {
+			return nil, syscall.EAGAIN
+		}
+		wake := s.wake
+		s.mu.Unlock()
+		err := wait(wake, deadline)
+		s.mu.Lock()
+		if s.closed {
+			return nil, syscall.EBADF
+		} else if err != nil && len(s.peers) == 0 {
+			return nil, err
+		}
+	}
+	peer := s.peers[s.next%len(s.peers)]
+	s.next++
+	return peer, nil
+}
+
+// Recv receives a message from the socket. The flags argument can be zero or
+// DontWait.
+func (s *Socket) Recv(flags int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, s.error("recv", syscall.EBADF)
+	}
+	switch s.protocol {
+	case PUB, PUSH:
+		return nil, s.error("recv", syscall.ENOTSUP)
+	case REQ, SURVEYOR:
+		if s.id == 0 {
+			return nil, s.error("recv", ErrState)
+		}
+	}
+
+	deadline := timeoutDeadline(s.recvTimeout)
+	if s.protocol == SURVEYOR && (deadline.IsZero() || s.surveyEnd.Before(deadline)) {
+		deadline = s.surveyEnd
+	}
+	for {
+		for len(s.queue) > 0 {
+			msg := s.queue[0]
+			s.queue = s.queue[1:]
+			switch s.protocol {
+			case REQ:
+				if msg.id != s.id {
+					continue
+				}
+				s.id = 0
+			case SURVEYOR:
+				if msg.id != s.id {
+					continue
+				}
+			case REP, RESPONDENT:
+				s.replyTo, s.replyID = msg.from, msg.id
+			}
+			return msg.data, nil
+		}
+		if flags&DontWait != 0 {
+			return nil, s.error("recv", syscall.EAGAIN)
+		}
+
+		wake := s.wake
+		s.mu.Unlock()
+		err := wait(wake, deadline)
+		s.mu.Lock()
+		if s.closed {
+			return nil, s.error("recv", syscall.EBADF)
+		} else if err != nil && len(s.queue) == 0 {
+			if s.protocol == SURVEYOR && !time.Now().Before(s.surveyEnd) {
+				// Once the survey has expired, no more responses are
+				// received until a new survey is sent.
+				s.id = 0
+			}
+			return nil, s.error("recv", err)
+		}
+	}
+}
+
+// SetSendTimeout sets the timeout for send operations. A negative timeout,
+// which is the default, is infinite.
+func (s *Socket) SetSendTimeout(timeout time.Duration) error {
+	s.mu.Lock()
+	s.sendTimeout = timeout
+	s.mu.Unlock()
+	return nil
+}
+
+// SetRecvTimeout sets the timeout for recv operations. A negative timeout,
+// which is the default, is infinite.
+func (s *Socket) SetRecvTimeout(timeout time.Duration) error {
+	s.mu.Lock()
+	s.recvTimeout = timeout
+	s.mu.Unlock()
+	return nil
+}
+
+// SetDeadline sets how long a SURVEYOR socket receives responses to a survey.
+func (s *Socket) SetDeadline(deadline time.Duration) error {
+	if s.protocol != SURVEYOR {
+		return s.error("setsockopt", syscall.ENOPROTOOPT)
+	}
+	s.mu.Lock()
+	s.deadline = deadline
+	s.mu.Unlock()
+	return nil
+}
+
+// Subscribe makes a SUB socket receive messages starting with topic.
+func (s *Socket) Subscribe(topic string) error {
+	if s.protocol != SUB {
+		return s.error("setsockopt", syscall.ENOPROTOOPT)
+	}
+	s.mu.Lock()
+	s.subscriptions = append(s.subscriptions, topic)
+	s.mu.Unlock()
+	return nil
+}
+
+// Unsubscribe removes a subscription added using Subscribe.
+func (s *Socket) Unsubscribe(topic string) error {
+	if s.protocol != SUB {
+		return s.error("setsockopt", syscall.ENOPROTOOPT)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.subscriptions {
+		if t == topic {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return s.error("setsockopt", syscall.EINVAL)
+}
@@ -0,0 +1,283 @@
+package nanomsgtest
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/op/go-nanomsg/sp"
+)
+
+func newPair(t *testing.T, n *Network, bind, connect Protocol) (*Socket, *Socket) {
+	t.Helper()
+	a, b := n.NewSocket(bind), n.NewSocket(connect)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	if err := a.Bind("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Connect("test"); err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func send(t *testing.T, s *Socket, msg string) {
+	t.Helper()
+	if _, err := s.Send([]byte(msg), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func recv(t *testing.T, s *Socket, expected string) {
+	t.Helper()
+	if data, err := s.Recv(0); err != nil {
+		t.Fatal(err)
+	} else if string(data) != expected {
+		t.Errorf("unexpected message: %q != %q", data, expected)
+	}
+}
+
+func TestPair(t *testing.T) {
+	a, b := newPair(t, NewNetwork(), PAIR, PAIR)
+	send(t, a, "ping")
+	recv(t, b, "ping")
+	send(t, b, "pong")
+	recv(t, a, "pong")
+
+	if _, err := a.Recv(DontWait); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	a.SetRecvTimeout(time.Millisecond)
+	if _, err := a.Recv(0); !errors.Is(err, syscall.ETIMEDOUT) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReqRep(t *testing.T) {
+	n := NewNetwork()
+	rep, req := newPair(t, n, REP, REQ)
+	if _, err := req.Recv(0); !errors.Is(err, ErrState) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := rep.Send([]byte("reply"), 0); !errors.Is(err, ErrState) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	req2 := n.NewSocket(REQ)
+	defer req2.Close()
+	if err := req2.Connect("test"); err != nil {
+		t.Fatal(err)
+	}
+	send(t, req, "one")
+	send(t, req2, "two")
+	recv(t, rep, "one")
+	send(t, rep, "reply one")
+	recv(t, rep, "two")
+	send(t, rep, "reply two")
+	recv(t, req2, "reply two")
+	recv(t, req, "reply one")
+
+	// A new request drops the reply to the previous one.
+	send(t, req, "three")
+	send(t, req, "four")
+	recv(t, rep, "three")
+	send(t, rep, "reply three")
+	recv(t, rep, "four")
+	send(t, rep, "reply four")
+	recv(t, req, "reply four")
+}
+
+func TestPubSub(t *testing.T) {
+	n := NewNetwork()
+	pub, sub := newPair(t, n, PUB, SUB)
+	if err := sub.Subscribe("a."); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Subscribe("a."); err == nil {
+		t.Error("expected error subscribing on PUB")
+	}
+	send(t, pub, "b.skipped")
+	send(t, pub, "a.received")
+	recv(t, sub, "a.received")
+	if _, err := sub.Recv(DontWait); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := sub.Send([]byte("a."), 0); !errors.Is(err, syscall.ENOTSUP) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := sub.Unsubscribe("a."); err != nil {
+		t.Fatal(err)
+	}
+	send(t, pub, "a.skipped")
+	if _, err := sub.Recv(DontWait); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	n := NewNetwork()
+	push := n.NewSocket(PUSH)
+	defer push.Close()
+	if _, err := push.Send([]byte("nobody"), DontWait); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	sent := make(chan error)
+	go func() {
+		_, err := push.Send([]byte("one"), 0)
+		sent <- err
+	}()
+	if err := push.Connect("test"); err != nil {
+		t.Fatal(err)
+	}
+	pull1, pull2 := n.NewSocket(PULL), n.NewSocket(PULL)
+	defer pull1.Close()
+	defer pull2.Close()
+	if err := pull1.Bind("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	recv(t, pull1, "one")
+
+	if err := push.Connect("test2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pull2.Bind("test2"); err != nil {
+		t.Fatal(err)
+	}
+	send(t, push, "two")
+	send(t, push, "three")
+	recv(t, pull2, "two")
+	recv(t, pull1, "three")
+}
+
+func TestBus(t *testing.T) {
+	n := NewNetwork()
+	a, b := newPair(t, n, BUS, BUS)
+	c := n.NewSocket(BUS)
+	defer c.Close()
+	if err := c.Connect("test"); err != nil {
+		t.Fatal(err)
+	}
+	send(t, a, "all")
+	recv(t, b, "all")
+	recv(t, c, "all")
+	send(t, b, "only a")
+	recv(t, a, "only a")
+	if _, err := c.Recv(DontWait); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSurvey(t *testing.T) {
+	n := NewNetwork()
+	surveyor, r1 := newPair(t, n, SURVEYOR, RESPONDENT)
+	r2 := n.NewSocket(RESPONDENT)
+	defer r2.Close()
+	if err := r2.Connect("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := surveyor.SetDeadline(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := surveyor.Recv(0); !errors.Is(err, ErrState) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	send(t, surveyor, "survey")
+	for _, r := range []*Socket{r1, r2} {
+		recv(t, r, "survey")
+		send(t, r, "response")
+	}
+	recv(t, surveyor, "response")
+	recv(t, surveyor, "response")
+	if _, err := surveyor.Recv(0); !errors.Is(err, syscall.ETIMEDOUT) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := surveyor.Recv(0); !errors.Is(err, ErrState) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	n := NewNetwork()
+	a, b := newPair(t, n, PAIR, PAIR)
+	received := make(chan error)
+	go func() {
+		_, err := a.Recv(0)
+		received <- err
+	}()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-received; !errors.Is(err, syscall.EBADF) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("unexpected error closing again: %v", err)
+	}
+
+	// The address is free to be bound again, and connected sockets are
+	// connected to the new socket.
+	c := n.NewSocket(PAIR)
+	defer c.Close()
+	if err := c.Bind("test"); err != nil {
+		t.Fatal(err)
+	}
+	send(t, b, "reconnected")
+	recv(t, c, "reconnected")
+}
+
+func TestPairOnePeer(t *testing.T) {
+	n := NewNetwork()
+	a, b := newPair(t, n, PAIR, PAIR)
+	c := n.NewSocket(PAIR)
+	defer c.Close()
+	if err := c.Connect("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Send([]byte("ignored"), DontWait); !errors.Is(err, sp.ErrWouldBlock) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	send(t, a, "ping")
+	recv(t, b, "ping")
+
+	// Once the peer is gone, the socket waiting to connect takes its place.
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	send(t, c, "pong")
+	recv(t, a, "pong")
+}
+
+func TestErrors(t *testing.T) {
+	n := NewNetwork()
+	rep, req := newPair(t, n, REP, REQ)
+	if _, err := req.Recv(0); !errors.Is(err, sp.EFSM) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := rep.Recv(DontWait); !errors.Is(err, sp.ErrWouldBlock) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	rep.SetRecvTimeout(time.Millisecond)
+	if _, err := rep.Recv(0); !errors.Is(err, sp.ErrTimeout) || errors.Is(err, sp.ErrSurveyExpired) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	rep.Close()
+	if _, err := rep.Recv(0); !errors.Is(err, sp.ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	surveyor, _ := newPair(t, NewNetwork(), SURVEYOR, RESPONDENT)
+	surveyor.SetDeadline(time.Millisecond)
+	send(t, surveyor, "survey")
+	if _, err := surveyor.Recv(0); !errors.Is(err, sp.ErrSurveyExpired) || !errors.Is(err, sp.ErrTimeout) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+// #include <nanomsg/nn.h>
+// #include <nanomsg/pubsub.h>
+// #include <nanomsg/reqrep.h>
+// #include <nanomsg/survey.h>
+import "C"
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// OptionType describes how the value of a socket option is represented in Go.
+type OptionType int
+
+const (
+	IntOption OptionType = iota
+	StringOption
+	DurationOption
+	BoolOption
+)
+
+func (t OptionType) String() string {
+	switch t {
+	case IntOption:
+		return "int"
+	case StringOption:
+		return "string"
+	case DurationOption:
+		return "duration"
+	case BoolOption:
+		return "bool"
+	}
+	return "OptionType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// OptionUnit is the unit nanomsg uses for the value of a socket option.
+type OptionUnit int
+
+const (
+	UnitNone         = OptionUnit(C.NN_UNIT_NONE)
+	UnitBytes        = OptionUnit(C.NN_UNIT_BYTES)
+	UnitMilliseconds = OptionUnit(C.NN_UNIT_MILLISECONDS)
+	UnitPriority     = OptionUnit(C.NN_UNIT_PRIORITY)
+	UnitBoolean      = OptionUnit(C.NN_UNIT_BOOLEAN)
+	UnitMessages     = OptionUnit(C.NN_UNIT_MESSAGES)
+	UnitCounter      = OptionUnit(C.NN_UNIT_COUNTER)
+)
+
+// Option describes a socket option known to the nanomsg library.
+type Option struct {
+	// Name is the nanomsg symbol name of the option, e.g. NN_LINGER.
+	Name string
+	// Level is the level the option lives at, e.g. NN_SOL_SOCKET for generic
+	// socket options or the transport or protocol for specific ones.
+	Level int
+	// Value is the option number within its level.
+	Value int
+	Type  OptionType
+	Unit  OptionUnit
+}
+
+var (
+	options = make(map[string]Option)
+	// optionNames maps the level and value of each option to its name.
+	optionNames = make(map[[2]int]string)
+)
+
+// protocolOptions lists the protocol specific options. These are not part of
+// the symbols exposed by nanomsg, but are settable by name all the same.
+var protocolOptions = []Option{
+	{"NN_SUB_SUBSCRIBE", int(C.NN_SUB), int(C.NN_SUB_SUBSCRIBE), StringOption, UnitNone},
+	{"NN_SUB_UNSUBSCRIBE", int(C.NN_SUB), int(C.NN_SUB_UNSUBSCRIBE), StringOption, UnitNone},
+	{"NN_REQ_RESEND_IVL", int(C.NN_REQ), int(C.NN_REQ_RESEND_IVL), DurationOption, UnitMilliseconds},
+	{"NN_SURVEYOR_DEADLINE", int(C.NN_SURVEYOR), int(C.NN_SURVEYOR_DEADLINE), DurationOption, UnitMilliseconds},
+}
+
+// registerOptions builds the option registry from the symbols exposed by the
+// nanomsg library.
+func registerOptions(infos []symbolInfo) {
+	var transports []symbolInfo
+	for _, info := range infos {
+		if info.namespace == C.NN_NS_TRANSPORT {
+			transports = append(transports, info)
+		}
+	}
+
+	for _, info := range infos {
+		var level int
+		switch info.namespace {
+		case C.NN_NS_SOCKET_OPTION:
+			level = C.NN_SOL_SOCKET
+		case C.NN_NS_TRANSPORT_OPTION:
+			// Transport options are prefixed with the transport name, eg.
+			// NN_TCP_NODELAY is found on the NN_TCP level.
+			found := false
+			for _, transport := range transports {
+				if strings.HasPrefix(info.name, transport.name+"_") {
+					level, found = transport.value, true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		default:
+			continue
+		}
+
+		opt := Option{Name: info.name, Level: level, Value: info.value}
+		switch {
+		case info.typ == C.NN_TYPE_STR:
+			opt.Type = StringOption
+		case info.unit == C.NN_UNIT_MILLISECONDS:
+			opt.Type = DurationOption
+		case info.unit == C.NN_UNIT_BOOLEAN:
+			opt.Type = BoolOption
+		default:
+			opt.Type = IntOption
+		}
+		opt.Unit = OptionUnit(info.unit)
+		options[opt.Name] = opt
+	}
+
+	for _, opt := range protocolOptions {
+		if _, exists := options[opt.Name]; !exists {
+			options[opt.Name] = opt
+		}
+	}
+	for _, opt := range options {
+		optionNames[[2]int{opt.Level, opt.Value}] = opt.Name
+	}
+}
+
+// optionSymbol returns the name of the option, or its level and value if the
+// option is unknown.
+func optionSymbol(level, option C.int) string {
+	if name, exists := optionNames[[2]int{int(level), int(option)}]; exists {
+		return name
+	}
+	return strconv.Itoa(int(level)) + "/" + strconv.Itoa(int(option))
+}
+
+// optionName turns a user supplied name like "linger" or "tcp-nodelay" into
+// the symbol name used by nanomsg.
+func optionName(name string) string {
+	name = strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	if !strings.HasPrefix(name, "NN_") {
+		name = "NN_" + name
+	}
+	return name
+}
+
+// LookupOption returns the option with the given name. The name is matched
+// case insensitively and the NN_ prefix is optional, making "linger",
+// "tcp_nodelay" and "NN_RCVTIMEO" all valid names.
+func LookupOption(name string) (Option, bool) {
+	opt, exists := options[optionName(name)]
+	return opt, exists
+}
+
+// KnownOptions returns all options known to the library, sorted by name.
+func KnownOptions() []Option {
+	opts := make([]Option, 0, len(options))
+	for _, opt := range options {
+		opts = append(opts, opt)
+	}
+	sort.Slice(opts, func(i, j int) bool { return opts[i].Name < opts[j].Name })
+	return opts
+}
+
+// GetOption returns the value of the named option. Depending on the type of
+// the option, the value is an int, string, time.Duration or bool. If the
+// option is unknown, the returned error wraps ENOPROTOOPT.
+func (s *Socket) GetOption(name string) (interface{}, error) {
+	opt, exists := LookupOption(name)
+	if !exists {
+		e := s.opError("getsockopt", "", syscall.ENOPROTOOPT)
+		e.Option = name
+		return nil, e
+	}
+	level, option := C.int(opt.Level), C.int(opt.Value)
+	switch opt.Type {
+	case StringOption:
+		return s.SockOptString(level, option, 255)
+	case DurationOption:
+		return s.SockOptDuration(level, option, time.Millisecond)
+	case BoolOption:
+		return s.SockOptBool(level, option)
+	default:
+		return s.SockOptInt(level, option)
+	}
+}
+
+// SetOption sets the value of the named option. The value must match the type
+// of the option; an int, string, time.Duration or bool. Values given as
+// strings are parsed into the type of the option, which makes it possible to
+// pass values from configuration files or command line flags as they are.
+func (s *Socket) SetOption(name string, value interface{}) error {
+	opt, exists := LookupOption(name)
+	if !exists {
+		e := s.opError("setsockopt", "", syscall.ENOPROTOOPT)
+		e.Option = name
+		return e
+	}
+	level, option := C.int(opt.Level), C.int(opt.Value)
+
+	if str, ok := value.(string); ok && opt.Type != StringOption {
+		var err error
+		if value, err = parseOption(opt, str); err != nil {
+			return err
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if opt.Type == StringOption {
+			return s.SetSockOptString(level, option, v)
+		}
+	case time.Duration:
+		if opt.Type == DurationOption {
+			return s.SetSockOptDuration(level, option, time.Millisecond, v)
+		}
+	case bool:
+		if opt.Type == BoolOption {
+			return s.SetSockOptBool(level, option, v)
+		}
+	case int:
+		if opt.Type == IntOption {
+			return s.SetSockOptInt(level, option, v)
+		}
+	case int64:
+		if opt.Type == IntOption {
+			return s.SetSockOptInt(level, option, int(v))
+		}
+	}
+	return fmt.Errorf("nanomsg: option %s expects %s value, got %T", opt.Name, opt.Type, value)
+}
+
+// parseOption parses the string representation of a value for the option.
+func parseOption(opt Option, value string) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch opt.Type {
+	case DurationOption:
+		v, err = time.ParseDuration(value)
+	case BoolOption:
+		v, err = strconv.ParseBool(value)
+	default:
+		v, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nanomsg: invalid %s value for option %s: %q", opt.Type, opt.Name, value)
+	}
+	return v, nil
+}
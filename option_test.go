@@ -0,0 +1,82 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLookupOption(t *testing.T) {
+	for _, name := range []string{"linger", "LINGER", "NN_LINGER"} {
+		if opt, ok := LookupOption(name); !ok {
+			t.Errorf("option %s not found", name)
+		} else if opt.Name != "NN_LINGER" || opt.Type != DurationOption {
+			t.Errorf("unexpected option for %s: %+v", name, opt)
+		}
+	}
+	if opt, ok := LookupOption("tcp-nodelay"); !ok {
+		t.Error("tcp-nodelay not found")
+	} else if opt.Type != BoolOption {
+		t.Errorf("unexpected type: %s", opt.Type)
+	}
+	if _, ok := LookupOption("no-such-option"); ok {
+		t.Error("unexpected option found")
+	}
+}
+
+func TestGetSetOption(t *testing.T) {
+	s, err := NewSocket(AF_SP, REQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.SetOption("linger", 150*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if linger, err := s.GetOption("linger"); err != nil {
+		t.Fatal(err)
+	} else if linger != 150*time.Millisecond {
+		t.Errorf("unexpected linger: %v", linger)
+	}
+
+	if err = s.SetOption("sndbuf", "65536"); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := s.SendBuffer(); err != nil {
+		t.Fatal(err)
+	} else if size != 65536 {
+		t.Errorf("unexpected send buffer: %d", size)
+	}
+
+	if err = s.SetOption("socket_name", "opt-sock"); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := s.GetOption("socket_name"); err != nil {
+		t.Fatal(err)
+	} else if name != "opt-sock" {
+		t.Errorf("unexpected name: %v", name)
+	}
+
+	if err = s.SetOption("req_resend_ivl", "2s"); err != nil {
+		t.Fatal(err)
+	}
+	if ivl, err := s.GetOption("req_resend_ivl"); err != nil {
+		t.Fatal(err)
+	} else if ivl != 2*time.Second {
+		t.Errorf("unexpected resend interval: %v", ivl)
+	}
+
+	if err = s.SetOption("linger", 150); err == nil {
+		t.Error("expected type mismatch")
+	}
+	if err = s.SetOption("sndbuf", "lots"); err == nil {
+		t.Error("expected parse failure")
+	}
+	if _, err = s.GetOption("no-such-option"); !errors.Is(err, syscall.ENOPROTOOPT) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -17,7 +17,7 @@ type PairSocket struct {
 // party can send messages at any time. If the peer is not available or send
 // buffer is full, subsequent calls to Send will block until it’s possible
 // to send the message.
-func NewPairSocket() (*PairSocket, error) {
-	socket, err := NewSocket(AF_SP, PAIR)
+func NewPairSocket(opts ...SocketOption) (*PairSocket, error) {
+	socket, err := NewSocket(AF_SP, PAIR, opts...)
 	return &PairSocket{socket}, err
 }
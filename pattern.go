@@ -0,0 +1,309 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Patterns consist of tokens separated by dots, where a token may be one of
+// the wildcards below, in the style of NATS subjects.
+const (
+	patternSeparator = "."
+	// patternAny matches a single token.
+	patternAny = "*"
+	// patternTail matches one or more tokens, and must be the last token.
+	patternTail = ">"
+)
+
+// parsePattern splits the pattern into tokens and returns the longest prefix
+// of the topics it matches. For patterns without wildcards, the prefix is the
+// topic followed by the delimiter.
+func parsePattern(pattern, delimiter string) (tokens []string, prefix string, err error) {
+	tokens = strings.Split(pattern, patternSeparator)
+	literal := -1
+	for i, token := range tokens {
+		switch {
+		case token == patternTail && i != len(tokens)-1:
+			return nil, "", fmt.Errorf("nanomsg: invalid pattern %q: %s must be the last token", pattern, patternTail)
+		case token == patternAny || token == patternTail:
+			if literal < 0 {
+				literal = i
+			}
+		case strings.ContainsAny(token, patternAny+patternTail):
+			return nil, "", fmt.Errorf("nanomsg: invalid pattern %q: wildcards must be whole tokens", pattern)
+		case strings.Contains(token, delimiter):
+			return nil, "", fmt.Errorf("nanomsg: invalid pattern %q: contains the topic delimiter", pattern)
+		}
+	}
+	if literal < 0 {
+		return tokens, pattern + delimiter, nil
+	} else if literal == 0 {
+		return tokens, "", nil
+	}
+	return tokens, strings.Join(tokens[:literal], patternSeparator) + patternSeparator, nil
+}
+
+// patternNode is a node in a trie of pattern tokens. Matching a topic visits
+// at most two children per token, regardless of the number of patterns.
+type patternNode struct {
+	children map[string]*patternNode
+	// exact counts the patterns ending at the node, and tail the patterns
+	// ending with a tail wildcard after it.
+	exact, tail int
+}
+
+func (n *patternNode) add(tokens []string) {
+	for i, token := range tokens {
+		if token == patternTail {
+			n.tail++
+			return
+		}
+		child := n.children[token]
+		if child == nil {
+			if n.children == nil {
+				n.children = make(map[string]*patternNode)
+			}
+			child = &patternNode{}
+			n.children[token] = child
+		}
+		n = child
+		if i == len(tokens)-1 {
+			n.exact++
+		}
+	}
+}
+
+// remove removes the pattern, pruning nodes left empty. It returns false if
+// the pattern was not added.
+func (n *patternNode) remove(tokens []string) bool {
+	token := tokens[0]
+	if token == patternTail {
+		if n.tail == 0 {
+			return false
+		}
+		n.tail--
+		return true
+	}
+	child := n.children[token]
+	if child == nil {
+		return false
+	}
+	if len(tokens) == 1 {
+		if child.exact == 0 {
+			return false
+		}
+		child.exact--
+	} else if !child.remove(tokens[1:]) {
+		return false
+	}
+	if child.empty() {
+		delete(n.children, token)
+	}
+	return true
+}
+
+func (n *patternNode) empty() bool {
+	return n.exact == 0 && n.tail == 0 && len(n.children) == 0
+}
+
+// match returns true if the topic matches any of the patterns. A tail
+// wildcard matches one or more tokens, so it does not match an empty topic.
+func (n *patternNode) match(topic string) bool {
+	if n.tail > 0 && topic != "" {
+		return true
+	}
+	token, rest, more := strings.Cut(topic, patternSeparator)
+	for _, key := range [...]string{token, patternAny} {
+		child := n.children[key]
+		if child == nil {
+			continue
+		}
+		if more {
+			if child.match(rest) {
+				return true
+			}
+		} else if child.exact > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixNode is a node in a trie of the bytes of the prefixes subscribed to
+// using Subscribe. Matching a message visits one node per byte of the longest
+// matching prefix, regardless of the number of prefixes.
+type prefixNode struct {
+	children map[byte]*prefixNode
+	// count counts the subscriptions to the prefix ending at the node.
+	count int
+}
+
+func (n *prefixNode) add(prefix string) {
+	for i := 0; i < len(prefix); i++ {
+		child := n.children[prefix[i]]
+		if child == nil {
+			if n.children == nil {
+				n.children = make(map[byte]*prefixNode)
+			}
+			child = &prefixNode{}
+			n.children[prefix[i]] = child
+		}
+		n = child
+	}
+	n.count++
+}
+
+// remove removes a subscription to the prefix, pruning nodes left empty. It
+// returns false if the prefix was not added.
+func (n *prefixNode) remove(prefix string) bool {
+	if prefix == "" {
+		if n.count == 0 {
+			return false
+		}
+		n.count--
+		return true
+	}
+	child := n.children[prefix[0]]
+	if child == nil || !child.remove(prefix[1:]) {
+		return false
+	}
+	if child.count == 0 && len(child.children) == 0 {
+		delete(n.children, prefix[0])
+	}
+	return true
+}
+
+// match returns true if the message starts with any of the prefixes.
+func (n *prefixNode) match(msg []byte) bool {
+	for _, b := range msg {
+		if n.count > 0 {
+			return true
+		}
+		if n = n.children[b]; n == nil {
+			return false
+		}
+	}
+	return n.count > 0
+}
+
+// subscriptions holds the subscriptions of a SUB socket, for filtering the
+// messages received when patterns are used. prefixes holds the subscriptions
+// made using Subscribe, and patterns those made using SubscribePattern.
+// delimiter is the topic delimiter of the socket, which can not change while
+// there are patterns, so that receiving only takes the read lock.
+type subscriptions struct {
+	mu        sync.RWMutex
+	prefixes  prefixNode
+	patterns  *patternNode
+	delimiter []byte
+}
+
+// subs returns the subscriptions of the socket, creating them if needed.
+func (sub *SubSocket) subs() *subscriptions {
+	if subs := sub.subscriptions.Load(); subs != nil {
+		return subs
+	}
+	sub.subscriptions.CompareAndSwap(nil, &subscriptions{})
+	return sub.subscriptions.Load()
+}
+
+// TopicDelimiter returns the delimiter separating the topic from the payload
+// in messages matched against patterns.
+func (sub *SubSocket) TopicDelimiter() string {
+	return sub.topicDelimiterOrDefault()
+}
+
+// SetTopicDelimiter sets the delimiter separating the topic from the payload
+// in messages matched against patterns. If empty, DefaultTopicDelimiter is
+// used. The delimiter can not contain the dot separating pattern tokens, and
+// can not be changed once patterns are subscribed to.
+func (sub *SubSocket) SetTopicDelimiter(delimiter string) error {
+	if strings.Contains(delimiter, patternSeparator) {
+		return fmt.Errorf("nanomsg: topic delimiter %q contains the pattern separator %q", delimiter, patternSeparator)
+	}
+	subs := sub.subs()
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	if subs.patterns != nil {
+		return errors.New("nanomsg: topic delimiter set after subscribing to patterns")
+	}
+	sub.mu.Lock()
+	sub.topicDelimiter = delimiter
+	sub.mu.Unlock()
+	return nil
+}
+
+// SubscribePattern subscribes to the topics matching the pattern. Patterns
+// consist of tokens separated by dots, where * matches a single token and >
+// matches one or more tokens at the end of the topic. For example,
+// "orders.*.eu" matches "orders.books.eu", and "orders.>" matches all topics
+// starting with "orders.".
+//
+// The socket subscribes to the literal prefix of the pattern, and messages
+// received which do not match are dropped by Recv. The topic is the part of
+// the message up to the topic delimiter, see SetTopicDelimiter. Subscriptions
+// made using Subscribe are not affected by patterns, but subscriptions made
+// using the sub_subscribe option are filtered as well.
+func (sub *SubSocket) SubscribePattern(pattern string) error {
+	subs := sub.subs()
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	delimiter := sub.topicDelimiterOrDefault()
+	tokens, prefix, err := parsePattern(pattern, delimiter)
+	if err != nil {
+		return err
+	}
+	if err = sub.subscribe(prefix); err != nil {
+		return err
+	}
+	if subs.patterns == nil {
+		subs.patterns = &patternNode{}
+		subs.delimiter = []byte(delimiter)
+	}
+	subs.patterns.add(tokens)
+	return nil
+}
+
+// UnsubscribePattern unsubscribes from a pattern added using
+// SubscribePattern.
+func (sub *SubSocket) UnsubscribePattern(pattern string) error {
+	subs := sub.subs()
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	tokens, prefix, err := parsePattern(pattern, sub.topicDelimiterOrDefault())
+	if err != nil {
+		return err
+	}
+	if subs.patterns == nil || !subs.patterns.remove(tokens) {
+		return nil
+	}
+	if subs.patterns.empty() {
+		subs.patterns = nil
+	}
+	return sub.unsubscribe(prefix)
+}
+
+// accept returns true if the message matches a subscription made using
+// Subscribe or SubscribePattern. Without patterns, all messages are accepted
+// as nanomsg has filtered them already.
+func (sub *SubSocket) accept(msg []byte) bool {
+	subs := sub.subscriptions.Load()
+	if subs == nil {
+		return true
+	}
+	subs.mu.RLock()
+	defer subs.mu.RUnlock()
+	if subs.patterns == nil || subs.prefixes.match(msg) {
+		return true
+	}
+	topic := msg
+	if i := bytes.Index(msg, subs.delimiter); i >= 0 {
+		topic = msg[:i]
+	}
+	return subs.patterns.match(string(topic))
+}
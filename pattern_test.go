@@ -0,0 +1,243 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParsePattern(t *testing.T) {
+	for pattern, prefix := range map[string]string{
+		"orders.*.eu": "orders.",
+		"orders.eu.>": "orders.eu.",
+		"orders.eu":   "orders.eu|",
+		"*.eu":        "",
+		">":           "",
+	} {
+		if _, p, err := parsePattern(pattern, "|"); err != nil {
+			t.Errorf("%s: %v", pattern, err)
+		} else if p != prefix {
+			t.Errorf("%s: unexpected prefix: %q", pattern, p)
+		}
+	}
+	for _, pattern := range []string{"orders.>.eu", "orders*", "orders.e>", "orders|eu"} {
+		if _, _, err := parsePattern(pattern, "|"); err == nil {
+			t.Errorf("%s: invalid pattern parsed", pattern)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	var root patternNode
+	patterns := []string{"orders.*.eu", "orders.books.>", "quotes.usd", "*.*.*.*"}
+	for _, pattern := range patterns {
+		tokens, _, _ := parsePattern(pattern, DefaultTopicDelimiter)
+		root.add(tokens)
+	}
+	for topic, match := range map[string]bool{
+		"orders.toys.eu":     true,
+		"orders.toys.us":     false,
+		"orders.books.us":    true,
+		"orders.books":       false,
+		"orders.books.eu.se": true,
+		"orders.eu":          false,
+		"quotes.usd":         true,
+		"quotes.usd.bid":     false,
+		"quotes.eur":         false,
+		"a.b.c.d":            true,
+		"a.b.c.d.e":          false,
+	} {
+		if root.match(topic) != match {
+			t.Errorf("%s: expected match %v", topic, match)
+		}
+	}
+
+	for _, pattern := range patterns {
+		tokens, _, _ := parsePattern(pattern, DefaultTopicDelimiter)
+		if !root.remove(tokens) {
+			t.Errorf("%s: not removed", pattern)
+		}
+		if root.remove(tokens) {
+			t.Errorf("%s: removed twice", pattern)
+		}
+	}
+	if !root.empty() {
+		t.Errorf("patterns left: %+v", root)
+	}
+}
+
+func TestPatternMatchTail(t *testing.T) {
+	var root patternNode
+	for _, pattern := range []string{">", "orders.>"} {
+		tokens, _, _ := parsePattern(pattern, DefaultTopicDelimiter)
+		root.add(tokens)
+	}
+	// A tail wildcard matches one or more tokens, never none.
+	for topic, match := range map[string]bool{
+		"":        false,
+		"orders":  true,
+		"a.b.c":   true,
+		"orders.": true,
+	} {
+		if root.match(topic) != match {
+			t.Errorf("%q: expected match %v", topic, match)
+		}
+	}
+	var orders patternNode
+	tokens, _, _ := parsePattern("orders.>", DefaultTopicDelimiter)
+	orders.add(tokens)
+	for topic, match := range map[string]bool{"orders": false, "orders.": false, "orders.eu": true} {
+		if orders.match(topic) != match {
+			t.Errorf("%q: expected match %v", topic, match)
+		}
+	}
+}
+
+func BenchmarkPatternMatch(b *testing.B) {
+	var root patternNode
+	for i := 0; i < 10000; i++ {
+		tokens, _, _ := parsePattern(fmt.Sprintf("orders.%d.*.eu", i), DefaultTopicDelimiter)
+		root.add(tokens)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.match("orders.5000.books.eu")
+	}
+}
+
+func TestPrefixMatch(t *testing.T) {
+	var root prefixNode
+	for _, prefix := range []string{"orders.eu", "orders", "audit\x00", "audit\x00"} {
+		root.add(prefix)
+	}
+	if !root.remove("orders.eu") || root.remove("orders.eu") || root.remove("missing") {
+		t.Error("unexpected removal")
+	}
+	root.remove("audit\x00")
+	for msg, match := range map[string]bool{
+		"orders":       true,
+		"orders.eu":    true,
+		"ordersX":      true,
+		"order":        false,
+		"audit\x00x":   true,
+		"audit":        false,
+		"auditing\x00": false,
+		"":             false,
+	} {
+		if root.match([]byte(msg)) != match {
+			t.Errorf("%q: expected match %v", msg, match)
+		}
+	}
+
+	// Nodes left empty are pruned, and the empty prefix matches everything.
+	root.remove("orders")
+	root.remove("audit\x00")
+	if len(root.children) != 0 {
+		t.Errorf("unexpected nodes: %v", root.children)
+	}
+	root.add("")
+	if !root.match(nil) || !root.match([]byte("anything")) {
+		t.Error("empty prefix did not match")
+	}
+}
+
+func BenchmarkPrefixMatch(b *testing.B) {
+	var root prefixNode
+	for i := 0; i < 10000; i++ {
+		root.add(fmt.Sprintf("orders.%d\x00", i))
+	}
+	msg := []byte("orders.5000\x00payload")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.match(msg)
+	}
+}
+
+func TestSubscribePattern(t *testing.T) {
+	pub, err := NewPubSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	if _, err = pub.Bind("inproc://patterns"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := NewSubSocket(WithRecvTimeout(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	for _, pattern := range []string{"orders.*.eu", "orders.books.eu"} {
+		if err = sub.SubscribePattern(pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sub.Subscribe("quotes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sub.Connect("inproc://patterns"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, topic := range []string{"orders.toys.us", "orders.toys.eu", "quotes.usd", "trades.eu"} {
+		if err = pub.Publish(topic, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, topic := range []string{"orders.toys.eu", "quotes.usd"} {
+		if msg, err := sub.Recv(0); err != nil {
+			t.Fatal(err)
+		} else if string(msg) != topic+DefaultTopicDelimiter+"x" {
+			t.Errorf("unexpected message: %q", msg)
+		}
+	}
+
+	// Topics matching only the removed pattern are no longer received.
+	if err = sub.UnsubscribePattern("orders.*.eu"); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"orders.toys.eu", "orders.books.eu"} {
+		if err = pub.Publish(topic, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg, err := sub.Recv(0); err != nil {
+		t.Fatal(err)
+	} else if string(msg) != "orders.books.eu"+DefaultTopicDelimiter {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	if _, err = sub.Recv(0); !errors.Is(err, ErrTimeout) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubscribePatternDelimiter(t *testing.T) {
+	sub, err := NewSubSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	// The delimiter can not be confused with the separator of the tokens.
+	if err = sub.SetTopicDelimiter("."); err == nil {
+		t.Error("expected error setting . as delimiter")
+	}
+	if err = sub.SetTopicDelimiter("|"); err != nil {
+		t.Fatal(err)
+	} else if d := (&SubSocket{sub.Socket}).TopicDelimiter(); d != "|" {
+		t.Errorf("unexpected delimiter: %q", d)
+	}
+	if err = sub.SubscribePattern("orders.*"); err != nil {
+		t.Fatal(err)
+	}
+	if err = sub.SetTopicDelimiter(":"); err == nil {
+		t.Error("expected error changing delimiter after subscribing")
+	}
+	for msg, accept := range map[string]bool{"orders.eu|x": true, "orders|x": false, "orders.eu.se|x": false} {
+		if sub.accept([]byte(msg)) != accept {
+			t.Errorf("%q: expected accept %v", msg, accept)
+		}
+	}
+}
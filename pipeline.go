@@ -17,8 +17,8 @@ type PushSocket struct {
 // NewPushSocket creates a socket which is used to send messages to a cluster
 // of load-balanced nodes. Receive operation is not implemented on this socket
 // type.
-func NewPushSocket() (*PushSocket, error) {
-	socket, err := NewSocket(AF_SP, PUSH)
+func NewPushSocket(opts ...SocketOption) (*PushSocket, error) {
+	socket, err := NewSocket(AF_SP, PUSH, opts...)
 	return &PushSocket{socket}, err
 }
 
@@ -28,7 +28,7 @@ type PullSocket struct {
 
 // NewPullSocket creates a socket which is used to receive a message from a
 // cluster of nodes. Send operation is not implemented on this socket type.
-func NewPullSocket() (*PullSocket, error) {
-	socket, err := NewSocket(AF_SP, PULL)
+func NewPullSocket(opts ...SocketOption) (*PullSocket, error) {
+	socket, err := NewSocket(AF_SP, PULL, opts...)
 	return &PullSocket{socket}, err
 }
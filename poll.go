@@ -6,12 +6,14 @@ package nanomsg
 import "C"
 
 import (
+	"syscall"
 	"time"
 )
 
 // Poller is used to poll a set of sockets for readability and/or writability.
 type Poller struct {
-	fds []C.struct_nn_pollfd
+	fds     []C.struct_nn_pollfd
+	sockets []*Socket
 }
 
 // Add puts the given socket into the poller to check when it's available for
@@ -19,9 +21,9 @@ type Poller struct {
 // socket is in or to modify what events to wait for.
 func (p *Poller) Add(s *Socket, recv, send bool) *PollItem {
 	var fd C.struct_nn_pollfd
-	fd.fd = s.socket
 	pi := &PollItem{p, len(p.fds)}
 	p.fds = append(p.fds, fd)
+	p.sockets = append(p.sockets, s)
 	pi.PollRecv(recv)
 	pi.PollSend(send)
 	return pi
@@ -32,16 +34,52 @@ func (p *Poller) Add(s *Socket, recv, send bool) *PollItem {
 // specify how long the function should block if there are no events.
 //
 // This function returns the number of events and error. If the poller timed
-// out before any event was received, the number of events will be 0.
+// out before any event was received, the number of events will be 0. If any
+// of the sockets has been closed, an error matching ErrClosed is returned.
+//
+// Closing one of the sockets while Poll is in progress waits for Poll to
+// return, which takes at most the timeout.
 func (p *Poller) Poll(timeout time.Duration) (int, error) {
+	// The sockets are looked up on each call, as nanomsg reuses the integers
+	// of closed sockets for new sockets, and are held until nn_poll returns
+	// so that the integers can not be handed out again meanwhile. Sockets
+	// added more than once are held once, as Close could otherwise be
+	// waiting between the two.
+	held := make(map[*Socket]C.int, len(p.sockets))
+	defer func() {
+		for s := range held {
+			s.release()
+		}
+	}()
+	for i, s := range p.sockets {
+		fd, exists := held[s]
+		if !exists {
+			var err error
+			if fd, err = s.hold(); err != nil {
+				return 0, s.opError("poll", "", err)
+			}
+			held[s] = fd
+		}
+		p.fds[i].fd = fd
+	}
 	t := C.int(timeout / time.Millisecond)
 	rc, err := C.nn_poll(&p.fds[0], C.int(len(p.fds)), t)
 	if rc == -1 {
-		return 0, nnError(err)
+		return 0, &OpError{Op: "poll", Err: nnError(err)}
 	}
 	return int(rc), nil
 }
 
+// Wait works like Poll, except that it returns an error matching ErrTimeout if
+// the poller timed out before any event was received.
+func (p *Poller) Wait(timeout time.Duration) (int, error) {
+	n, err := p.Poll(timeout)
+	if err == nil && n == 0 {
+		return 0, &OpError{Op: "poll", Err: syscall.ETIMEDOUT}
+	}
+	return n, err
+}
+
 // PollItem represents a socket and what events to poll for.
 type PollItem struct {
 	poller *Poller
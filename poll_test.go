@@ -3,6 +3,7 @@
 package nanomsg
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -66,3 +67,69 @@ func TestPoller(t *testing.T) {
 		t.Error("no events should be available")
 	}
 }
+
+func TestPollerWait(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var poller Poller
+	poller.Add(s.Socket, true, false)
+	if _, err := poller.Wait(time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPollerClosed(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var poller Poller
+	poller.Add(s.Socket, true, false)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The integer of the closed socket is likely to be handed out again.
+	s2, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if _, err = poller.Poll(time.Millisecond); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPollerCloseInFlight(t *testing.T) {
+	s, err := NewPairSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var poller Poller
+	poller.Add(s.Socket, true, false)
+	poller.Add(s.Socket, true, false)
+
+	polled := make(chan error)
+	go func() {
+		_, err := poller.Poll(100 * time.Millisecond)
+		polled <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// Close waits for the poll to return before the integer can be reused,
+	// and neither blocks on the other although the socket is held once.
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatal("poll did not return")
+	}
+	if _, err = poller.Poll(time.Millisecond); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package protocodec provides codecs encoding protocol buffer messages, for
+// use with the typed sockets of the nanomsg package and the rpc package.
+//
+// It lives in a package of its own so that the nanomsg package only depends on
+// the standard library.
+package protocodec
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Marshaler is implemented by protocol buffer messages with generated
+// marshaling code, such as the messages generated by gogoproto with the
+// marshaler, sizer and unmarshaler plugins enabled. The codecs use these
+// methods when available, and the proto package otherwise.
+type Marshaler interface {
+	Reset()
+	Size() int
+	MarshalTo(data []byte) (int, error)
+	Unmarshal(data []byte) error
+}
+
+// appendProto appends the encoded message to dst.
+func appendProto(dst []byte, v any) ([]byte, error) {
+	switch m := v.(type) {
+	case Marshaler:
+		size := m.Size()
+		dst = slices.Grow(dst, size)
+		n, err := m.MarshalTo(dst[len(dst) : len(dst)+size])
+		if err != nil {
+			return nil, err
+		}
+		return dst[:len(dst)+n], nil
+	case proto.Message:
+		return proto.MarshalOptions{}.MarshalAppend(dst, m)
+	}
+	return nil, fmt.Errorf("can not encode %T", v)
+}
+
+// unmarshalProto resets the message and decodes data into it.
+func unmarshalProto(data []byte, v any) error {
+	switch m := v.(type) {
+	case Marshaler:
+		m.Reset()
+		return m.Unmarshal(data)
+	case proto.Message:
+		return proto.UnmarshalOptions{}.Unmarshal(data, m)
+	}
+	return fmt.Errorf("can not decode into %T", v)
+}
+
+// Codec encodes protocol buffer messages of type M. Messages generated by
+// protoc-gen-go are encoded using the proto package, and messages implementing
+// Marshaler using their generated code, without going through reflection.
+// Used with TypedSocket, messages are encoded into reused buffers, and decoded
+// into messages taken from a pool. Pass decoded messages to Release once done
+// with them to reuse them.
+//
+// The type parameters are the message and its pointer type, e.g.
+//
+//	codec := &protocodec.Codec[pb.Request, *pb.Request]{}
+//	socket := nanomsg.NewTypedSocket[*pb.Request](conn, codec)
+type Codec[M any, PM interface {
+	*M
+	Reset()
+}] struct {
+	pool sync.Pool
+}
+
+func (c *Codec[M, PM]) Name() string {
+	return "proto"
+}
+
+func (c *Codec[M, PM]) Marshal(v any) ([]byte, error) {
+	return c.AppendMarshal(nil, v)
+}
+
+func (c *Codec[M, PM]) AppendMarshal(dst []byte, v any) ([]byte, error) {
+	m, ok := v.(PM)
+	if !ok {
+		return nil, fmt.Errorf("can not encode %T", v)
+	}
+	return appendProto(dst, m)
+}
+
+// Unmarshal decodes the message into v, which is either a message or a
+// pointer to one. If it points to nil, a message is taken from the pool.
+func (c *Codec[M, PM]) Unmarshal(data []byte, v any) error {
+	var m PM
+	switch v := v.(type) {
+	case PM:
+		m = v
+	case *PM:
+		if *v == nil {
+			*v = c.get()
+		}
+		m = *v
+	default:
+		return fmt.Errorf("can not decode into %T", v)
+	}
+	return unmarshalProto(data, m)
+}
+
+func (c *Codec[M, PM]) get() PM {
+	if m, ok := c.pool.Get().(PM); ok {
+		return m
+	}
+	return PM(new(M))
+}
+
+// Release resets the message and returns it to the pool of messages used for
+// decoding. The message must not be used after it has been released.
+func (c *Codec[M, PM]) Release(m PM) {
+	m.Reset()
+	c.pool.Put(m)
+}
+
+// MessageCodec encodes protocol buffer messages of any type, for sockets
+// carrying more than one type of message, such as the sockets of the rpc
+// package. Like Codec, it uses the generated code of messages implementing
+// Marshaler, but decoded messages are not pooled.
+type MessageCodec struct{}
+
+func (MessageCodec) Name() string {
+	return "proto"
+}
+
+func (c MessageCodec) Marshal(v any) ([]byte, error) {
+	return c.AppendMarshal(nil, v)
+}
+
+func (MessageCodec) AppendMarshal(dst []byte, v any) ([]byte, error) {
+	return appendProto(dst, v)
+}
+
+// Unmarshal decodes the message into v, which is either a message or a
+// pointer to one. If it points to nil, a new message is allocated.
+func (MessageCodec) Unmarshal(data []byte, v any) error {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		v = rv.Elem().Interface()
+	}
+	return unmarshalProto(data, v)
+}
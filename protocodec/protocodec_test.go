@@ -0,0 +1,168 @@
+package protocodec
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/op/go-nanomsg"
+	"github.com/op/go-nanomsg/nanomsgtest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// request mimics a message generated by gogoproto, with an id as field 1 and
+// a name as field 2.
+type request struct {
+	ID   uint64
+	Name string
+}
+
+func (r *request) Reset() {
+	*r = request{}
+}
+
+func (r *request) Size() int {
+	n := 1 + binary.PutUvarint(make([]byte, binary.MaxVarintLen64), r.ID)
+	if r.Name != "" {
+		n += 1 + binary.PutUvarint(make([]byte, binary.MaxVarintLen64), uint64(len(r.Name))) + len(r.Name)
+	}
+	return n
+}
+
+func (r *request) MarshalTo(data []byte) (int, error) {
+	data = append(data[:0], 1<<3)
+	data = binary.AppendUvarint(data, r.ID)
+	if r.Name != "" {
+		data = append(data, 2<<3|2)
+		data = binary.AppendUvarint(data, uint64(len(r.Name)))
+		data = append(data, r.Name...)
+	}
+	return len(data), nil
+}
+
+func (r *request) Unmarshal(data []byte) error {
+	for len(data) > 0 {
+		key := data[0]
+		value, n := binary.Uvarint(data[1:])
+		if n <= 0 {
+			return errors.New("invalid varint")
+		}
+		data = data[1+n:]
+		switch key {
+		case 1 << 3:
+			r.ID = value
+		case 2<<3 | 2:
+			if uint64(len(data)) < value {
+				return errors.New("truncated field")
+			}
+			r.Name, data = string(data[:value]), data[value:]
+		default:
+			return errors.New("unknown field")
+		}
+	}
+	return nil
+}
+
+func TestCodec(t *testing.T) {
+	n := nanomsgtest.NewNetwork()
+	a, b := n.NewSocket(nanomsgtest.PAIR), n.NewSocket(nanomsgtest.PAIR)
+	if err := a.Bind("proto"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Connect("proto"); err != nil {
+		t.Fatal(err)
+	}
+	codec := &Codec[request, *request]{}
+	sender := nanomsg.NewTypedSocket[*request](a, codec)
+	defer sender.Close()
+	receiver := nanomsg.NewTypedSocket[*request](b, codec)
+	defer receiver.Close()
+
+	for _, sent := range []request{{ID: 300, Name: "first"}, {ID: 1}} {
+		if err := sender.Send(&sent); err != nil {
+			t.Fatal(err)
+		}
+		received, err := receiver.Recv()
+		if err != nil {
+			t.Fatal(err)
+		} else if *received != sent {
+			t.Errorf("unexpected message: %+v != %+v", *received, sent)
+		}
+		codec.Release(received)
+	}
+
+	if _, err := a.Send([]byte{0xff}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Recv(); err == nil {
+		t.Error("expected decode error")
+	}
+	if _, err := codec.Marshal("not a message"); err == nil {
+		t.Error("expected encode error")
+	}
+}
+
+func TestCodecMessage(t *testing.T) {
+	n := nanomsgtest.NewNetwork()
+	a, b := n.NewSocket(nanomsgtest.PAIR), n.NewSocket(nanomsgtest.PAIR)
+	if err := a.Bind("proto"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Connect("proto"); err != nil {
+		t.Fatal(err)
+	}
+	codec := &Codec[wrapperspb.StringValue, *wrapperspb.StringValue]{}
+	sender := nanomsg.NewTypedSocket[*wrapperspb.StringValue](a, codec)
+	defer sender.Close()
+	receiver := nanomsg.NewTypedSocket[*wrapperspb.StringValue](b, codec)
+	defer receiver.Close()
+
+	for _, sent := range []string{"first", ""} {
+		if err := sender.Send(wrapperspb.String(sent)); err != nil {
+			t.Fatal(err)
+		}
+		received, err := receiver.Recv()
+		if err != nil {
+			t.Fatal(err)
+		} else if received.GetValue() != sent {
+			t.Errorf("unexpected message: %q != %q", received.GetValue(), sent)
+		}
+		codec.Release(received)
+	}
+}
+
+func TestMessageCodec(t *testing.T) {
+	var codec MessageCodec
+	for _, sent := range []any{wrapperspb.Int64(300), &request{ID: 300, Name: "gogo"}} {
+		data, err := codec.AppendMarshal([]byte("prefix"), sent)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(data[:6]) != "prefix" {
+			t.Fatalf("prefix overwritten: %q", data)
+		}
+		switch sent := sent.(type) {
+		case *wrapperspb.Int64Value:
+			var received *wrapperspb.Int64Value
+			if err = codec.Unmarshal(data[6:], &received); err != nil {
+				t.Fatal(err)
+			} else if !proto.Equal(received, sent) {
+				t.Errorf("unexpected message: %v != %v", received, sent)
+			}
+		case *request:
+			received := &request{ID: 1, Name: "reset"}
+			if err = codec.Unmarshal(data[6:], received); err != nil {
+				t.Fatal(err)
+			} else if *received != *sent {
+				t.Errorf("unexpected message: %+v != %+v", *received, *sent)
+			}
+		}
+	}
+	if _, err := codec.Marshal("not a message"); err == nil {
+		t.Error("expected encode error")
+	}
+	var s string
+	if err := codec.Unmarshal(nil, &s); err == nil {
+		t.Error("expected decode error")
+	}
+}
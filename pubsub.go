@@ -5,6 +5,11 @@ package nanomsg
 // #include <nanomsg/pubsub.h>
 import "C"
 
+import (
+	"errors"
+	"strings"
+)
+
 const (
 	PUB = Protocol(C.NN_PUB)
 	SUB = Protocol(C.NN_SUB)
@@ -19,19 +24,55 @@ type SubSocket struct {
 // the socket is created there are no subscriptions and thus no messages will
 // be received. Send operation is not defined on this socket. The socket can
 // be connected to at most one peer.
-func NewSubSocket() (*SubSocket, error) {
-	socket, err := NewSocket(AF_SP, SUB)
+func NewSubSocket(opts ...SocketOption) (*SubSocket, error) {
+	socket, err := NewSocket(AF_SP, SUB, opts...)
 	return &SubSocket{socket}, err
 }
 
 // Subscribe subscribes to a particular topic.
 func (sub *SubSocket) Subscribe(topic string) error {
-	return sub.SetSockOptString(C.NN_SUB, C.NN_SUB_SUBSCRIBE, topic)
+	if err := sub.subscribe(topic); err != nil {
+		return err
+	}
+	subs := sub.subs()
+	subs.mu.Lock()
+	subs.prefixes.add(topic)
+	subs.mu.Unlock()
+	return nil
 }
 
 // Unsubscribe unsubscribes from a particular topic.
 func (sub *SubSocket) Unsubscribe(topic string) error {
-	return sub.SetSockOptString(C.NN_SUB, C.NN_SUB_UNSUBSCRIBE, topic)
+	if err := sub.unsubscribe(topic); err != nil {
+		return err
+	}
+	subs := sub.subs()
+	subs.mu.Lock()
+	subs.prefixes.remove(topic)
+	subs.mu.Unlock()
+	return nil
+}
+
+func (sub *SubSocket) subscribe(prefix string) error {
+	return sub.SetSockOptString(C.NN_SUB, C.NN_SUB_SUBSCRIBE, prefix)
+}
+
+func (sub *SubSocket) unsubscribe(prefix string) error {
+	return sub.SetSockOptString(C.NN_SUB, C.NN_SUB_UNSUBSCRIBE, prefix)
+}
+
+// Recv receives a message from the socket. Messages which only match the
+// literal prefix of a pattern added using SubscribePattern, and not the
+// pattern itself, are dropped. As the receive timeout applies to each message
+// received, Recv may block for longer than the timeout when messages are
+// dropped.
+func (sub *SubSocket) Recv(flags int) ([]byte, error) {
+	for {
+		data, err := sub.Socket.Recv(flags)
+		if err != nil || sub.accept(data) {
+			return data, err
+		}
+	}
 }
 
 type PubSocket struct {
@@ -40,7 +81,64 @@ type PubSocket struct {
 
 // NewPubSocket creates a new socket which is used to distribute messages to
 // multiple destinations. Receive operation is not defined.
-func NewPubSocket() (*PubSocket, error) {
-	socket, err := NewSocket(AF_SP, PUB)
+func NewPubSocket(opts ...SocketOption) (*PubSocket, error) {
+	socket, err := NewSocket(AF_SP, PUB, opts...)
 	return &PubSocket{socket}, err
 }
+
+// topicDelimiterOrDefault returns the delimiter set by SetTopicDelimiter, or
+// DefaultTopicDelimiter if none is set.
+func (s *Socket) topicDelimiterOrDefault() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.topicDelimiter == "" {
+		return DefaultTopicDelimiter
+	}
+	return s.topicDelimiter
+}
+
+// TopicDelimiter returns the delimiter separating the topic from the payload
+// in messages sent using Publish.
+func (pub *PubSocket) TopicDelimiter() string {
+	return pub.topicDelimiterOrDefault()
+}
+
+// SetTopicDelimiter sets the delimiter separating the topic from the payload
+// in messages sent using Publish. If empty, DefaultTopicDelimiter is used.
+func (pub *PubSocket) SetTopicDelimiter(delimiter string) {
+	pub.mu.Lock()
+	pub.topicDelimiter = delimiter
+	pub.mu.Unlock()
+}
+
+// ErrTopicDelimiter is returned when publishing on a topic which contains the
+// topic delimiter.
+var ErrTopicDelimiter = errors.New("nanomsg: topic contains the delimiter")
+
+// Publish sends the payload on the topic. The message consists of the topic,
+// the delimiter and the payload, which is what Subscriber expects.
+//
+// As the delimiter follows the topic, subscribing to the topic and the
+// delimiter receives the messages of that topic only. Subscribing to "order"
+// also receives messages published on "orders", while subscribing to "order"
+// followed by the delimiter does not.
+func (pub *PubSocket) Publish(topic string, payload []byte) error {
+	delimiter := pub.topicDelimiterOrDefault()
+	if strings.Contains(topic, delimiter) {
+		return ErrTopicDelimiter
+	}
+	msg := make([]byte, 0, len(topic)+len(delimiter)+len(payload))
+	msg = append(append(append(msg, topic...), delimiter...), payload...)
+	_, err := pub.Send(msg, 0)
+	return err
+}
+
+// PublishValue encodes the value using the codec and publishes it on the
+// topic. If the value can not be encoded, a *CodecError is returned.
+func PublishValue[T any](pub *PubSocket, codec Codec, topic string, v T) error {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return &CodecError{"encode", codec.Name(), err}
+	}
+	return pub.Publish(topic, payload)
+}
@@ -74,3 +74,72 @@ func TestPubSub(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPublish(t *testing.T) {
+	pub, err := NewPubSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	if _, err = pub.Bind("inproc://publish"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := NewSubSocket(WithRecvTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	var received point
+	s := NewSubscriber(sub)
+	err = s.Handle("order"+DefaultTopicDelimiter, func(topic string, payload []byte) {
+		if topic != "order" {
+			t.Errorf("unexpected topic: %q", topic)
+		}
+		if err := (JSONCodec{}).Unmarshal(payload, &received); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sub.Connect("inproc://publish"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = pub.Publish("orders", []byte("skipped")); err != nil {
+		t.Fatal(err)
+	}
+	if err = PublishValue(pub, JSONCodec{}, "order", point{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Publish("order"+DefaultTopicDelimiter, nil); err != ErrTopicDelimiter {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	msg, err := sub.Recv(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Dispatch(msg) || received != (point{1, 2}) {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
+
+func TestPublishDelimiter(t *testing.T) {
+	pub, err := NewPubSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	if d := pub.TopicDelimiter(); d != DefaultTopicDelimiter {
+		t.Errorf("unexpected delimiter: %q", d)
+	}
+	// The delimiter is kept by the socket, and seen by other wrappers of it.
+	pub.SetTopicDelimiter("|")
+	if d := (&PubSocket{pub.Socket}).TopicDelimiter(); d != "|" {
+		t.Errorf("unexpected delimiter: %q", d)
+	}
+	if err = pub.Publish("order|eu", nil); err != ErrTopicDelimiter {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
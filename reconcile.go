@@ -0,0 +1,214 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointSpec describes an endpoint a socket should have.
+type EndpointSpec struct {
+	Address string
+	// Bind is true if the socket should bind to the address, and false if it
+	// should connect to it.
+	Bind bool
+}
+
+func (e EndpointSpec) String() string {
+	if e.Bind {
+		return "bind " + e.Address
+	}
+	return "connect " + e.Address
+}
+
+// ParseEndpointSpecs parses a list of endpoints, one per line, in the form
+// "bind <address>" or "connect <address>". Empty lines and lines starting with
+// # are ignored.
+func ParseEndpointSpecs(r io.Reader) ([]EndpointSpec, error) {
+	var specs []EndpointSpec
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || (fields[0] != "bind" && fields[0] != "connect") {
+			return nil, fmt.Errorf("nanomsg: line %d: expected bind or connect followed by an address", n)
+		}
+		if _, err := ParseAddr(fields[1]); err != nil {
+			return nil, fmt.Errorf("nanomsg: line %d: %w", n, err)
+		}
+		specs = append(specs, EndpointSpec{Address: fields[1], Bind: fields[0] == "bind"})
+	}
+	return specs, scanner.Err()
+}
+
+// Reconciler keeps the endpoints of a socket in line with a list of desired
+// endpoints, binding, connecting and shutting down endpoints as the list
+// changes.
+//
+// Endpoints already added to the socket are kept if they are part of the
+// desired list and shut down otherwise.
+type Reconciler struct {
+	Socket *Socket
+	// RetryInterval is how long Run waits before retrying endpoints which
+	// failed to be added. Default is 1 second.
+	RetryInterval time.Duration
+	// Logger is used to log changes to the endpoints. If nil, nothing is
+	// logged by the reconciler, as the socket already logs the endpoints it
+	// adds and shuts down to the logger set using SetLogger.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	managed map[EndpointSpec]*Endpoint
+}
+
+// NewReconciler creates a reconciler for the socket.
+func NewReconciler(s *Socket) *Reconciler {
+	return &Reconciler{Socket: s}
+}
+
+// Reconcile adds and removes endpoints on the socket until it matches the
+// desired list. Endpoints which can not be added are reported in the returned
+// error, and are tried again on the next call.
+func (r *Reconciler) Reconcile(desired []EndpointSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.managed == nil {
+		r.managed = make(map[EndpointSpec]*Endpoint)
+	}
+	logger := orDiscard(r.Logger)
+
+	// Match the endpoints on the socket with the ones we know about and shut
+	// down the ones which no longer are wanted.
+	current := make(map[EndpointSpec]*Endpoint)
+	for _, endpoint := range r.Socket.Endpoints() {
+		spec := EndpointSpec{endpoint.Address, endpoint.Bound()}
+		for s, e := range r.managed {
+			if e.endpoint == endpoint.endpoint {
+				spec = s
+				break
+			}
+		}
+		if !slices.Contains(desired, spec) {
+			if err := endpoint.Shutdown(); err != nil {
+				logger.Error("nanomsg: failed to shut down endpoint", "address", endpoint.Address, "error", err)
+				current[spec] = endpoint
+				continue
+			}
+			logger.Info("nanomsg: shut down endpoint", "address", endpoint.Address)
+			continue
+		}
+		current[spec] = endpoint
+	}
+	r.managed = current
+
+	var errs []error
+	for _, spec := range desired {
+		if _, exists := r.managed[spec]; exists {
+			continue
+		}
+		var endpoint *Endpoint
+		var err error
+		if spec.Bind {
+			endpoint, err = r.Socket.Bind(spec.Address)
+		} else {
+			endpoint, err = r.Socket.Connect(spec.Address)
+		}
+		if err != nil {
+			logger.Error("nanomsg: failed to add endpoint", "endpoint", spec.String(), "error", err)
+			errs = append(errs, fmt.Errorf("nanomsg: %s: %w", spec, err))
+			continue
+		}
+		logger.Info("nanomsg: added endpoint", "endpoint", spec.String(), "address", endpoint.Address)
+		r.managed[spec] = endpoint
+	}
+	return errors.Join(errs...)
+}
+
+// Run reconciles the socket each time a new list of endpoints is received on
+// updates. Endpoints which fail to be added are retried every RetryInterval.
+// Run returns when the context is done or when updates is closed.
+func (r *Reconciler) Run(ctx context.Context, updates <-chan []EndpointSpec) error {
+	interval := r.RetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var desired []EndpointSpec
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case specs, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			desired = specs
+		case <-retry:
+		}
+		retry = nil
+		if err := r.Reconcile(desired); err != nil {
+			retry = time.After(interval)
+		}
+	}
+}
+
+// WatchFile reads the list of endpoints from the file at path, and checks it
+// for changes every interval. The initial list and any subsequent changes to it
+// are sent on the returned channel, which is closed when the context is done.
+// See ParseEndpointSpecs for the format of the file. If the file can not be
+// read or parsed, the error is logged to logger and the previous list is kept.
+// A nil logger disables logging.
+func WatchFile(ctx context.Context, path string, interval time.Duration, logger *slog.Logger) <-chan []EndpointSpec {
+	logger = orDiscard(logger)
+	updates := make(chan []EndpointSpec)
+	go func() {
+		defer close(updates)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last []EndpointSpec
+		first := true
+		for {
+			specs, err := readEndpointSpecs(path)
+			if err != nil {
+				logger.Error("nanomsg: failed to read endpoints", "path", path, "error", err)
+			} else if first || !slices.Equal(specs, last) {
+				select {
+				case updates <- specs:
+					last, first = specs, false
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+func readEndpointSpecs(path string) ([]EndpointSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseEndpointSpecs(f)
+}
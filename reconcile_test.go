@@ -0,0 +1,137 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEndpointSpecs(t *testing.T) {
+	specs, err := ParseEndpointSpecs(strings.NewReader(`
+# upstreams
+bind tcp://*:5555
+connect  tcp://10.0.0.1:5555
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []EndpointSpec{{"tcp://*:5555", true}, {"tcp://10.0.0.1:5555", false}}
+	if !slices.Equal(specs, expected) {
+		t.Errorf("unexpected specs: %v", specs)
+	}
+
+	for _, input := range []string{"listen tcp://*:5555", "bind", "connect tcp://10.0.0.1"} {
+		if _, err := ParseEndpointSpecs(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected failure", input)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	s, err := NewSocket(AF_SP, PAIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Endpoints not added by the reconciler are kept if desired.
+	if _, err = s.Bind("inproc://reconcile-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Bind("inproc://reconcile-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a logger, the changes are only logged by the socket.
+	var buf bytes.Buffer
+	s.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	r := NewReconciler(s)
+	err = r.Reconcile([]EndpointSpec{
+		{"inproc://reconcile-a", true},
+		{"inproc://reconcile-c", false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range []string{"inproc://reconcile-b", "inproc://reconcile-c"} {
+		if n := strings.Count(buf.String(), address); n != 1 {
+			t.Errorf("%s logged %d times:\n%s", address, n, buf.String())
+		}
+	}
+	addresses := func() []string {
+		var addresses []string
+		for _, endpoint := range s.Endpoints() {
+			addresses = append(addresses, endpoint.Address)
+		}
+		return addresses
+	}
+	if a := addresses(); !slices.Equal(a, []string{"inproc://reconcile-a", "inproc://reconcile-c"}) {
+		t.Errorf("unexpected endpoints: %v", a)
+	}
+
+	// Failing endpoints are reported while the rest are applied.
+	err = r.Reconcile([]EndpointSpec{
+		{"inproc://reconcile-c", false},
+		{"tcp://127.0.0.1:0", false},
+	})
+	if err == nil {
+		t.Error("expected failure")
+	}
+	if a := addresses(); !slices.Equal(a, []string{"inproc://reconcile-c"}) {
+		t.Errorf("unexpected endpoints: %v", a)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints")
+	if err := os.WriteFile(path, []byte("bind inproc://watch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors are logged to the given logger, which is read through a pipe.
+	r, w := io.Pipe()
+	logged := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if strings.Contains(scanner.Text(), "failed to read endpoints") {
+				close(logged)
+				break
+			}
+		}
+		io.Copy(io.Discard, r)
+	}()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := WatchFile(ctx, path, time.Millisecond, slog.New(slog.NewTextHandler(w, nil)))
+
+	if specs := <-updates; !slices.Equal(specs, []EndpointSpec{{"inproc://watch", true}}) {
+		t.Errorf("unexpected specs: %v", specs)
+	}
+	if err := os.WriteFile(path, []byte("listen inproc://watch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	<-logged
+	if err := os.WriteFile(path, []byte("connect inproc://watch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if specs := <-updates; !slices.Equal(specs, []EndpointSpec{{"inproc://watch", false}}) {
+		t.Errorf("unexpected specs: %v", specs)
+	}
+
+	cancel()
+	for range updates {
+	}
+}
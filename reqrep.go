@@ -20,8 +20,8 @@ type ReqSocket struct {
 
 // NewReqSocket creates a request socket used to implement the client
 // application that sends requests and receives replies.
-func NewReqSocket() (*ReqSocket, error) {
-	socket, err := NewSocket(AF_SP, REQ)
+func NewReqSocket(opts ...SocketOption) (*ReqSocket, error) {
+	socket, err := NewSocket(AF_SP, REQ, opts...)
 	return &ReqSocket{socket}, err
 }
 
@@ -43,7 +43,7 @@ type RepSocket struct {
 
 // NewRepSocket creates a reply socket used to implement the stateless worker
 // that receives requests and sends replies.
-func NewRepSocket() (*RepSocket, error) {
-	socket, err := NewSocket(AF_SP, REP)
+func NewRepSocket(opts ...SocketOption) (*RepSocket, error) {
+	socket, err := NewSocket(AF_SP, REP, opts...)
 	return &RepSocket{socket}, err
 }
@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/op/go-nanomsg"
+)
+
+// recvInterval is the longest a client waits in a single receive, bounding how
+// long it takes to notice that the context of a call is cancelled.
+const recvInterval = 100 * time.Millisecond
+
+// Conn is the socket used by a client. It is implemented by *nanomsg.ReqSocket.
+type Conn interface {
+	nanomsg.Conn
+	SetRecvTimeout(timeout time.Duration) error
+}
+
+var _ Conn = (*nanomsg.ReqSocket)(nil)
+
+// Client calls methods on a server using a REQ socket. A REQ socket has one
+// request in flight at a time, so calls made concurrently are serialized.
+//
+// The client controls the receive timeout of the socket.
+type Client struct {
+	// Timeout is the timeout of calls made with a context without a
+	// deadline. Zero means no timeout.
+	Timeout time.Duration
+
+	conn  Conn
+	codec nanomsg.Codec
+	mu    sync.Mutex
+}
+
+// NewClient creates a client using the codec to encode arguments and decode
+// results. If codec is nil, nanomsg.JSONCodec is used.
+func NewClient(conn Conn, codec nanomsg.Codec) *Client {
+	if codec == nil {
+		codec = nanomsg.JSONCodec{}
+	}
+	return &Client{conn: conn, codec: codec}
+}
+
+// Close closes the socket of the client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call calls the method with the argument and waits for the result. The time
+// left until the deadline of the context, and any metadata added to it using
+// WithMetadata, are sent to the server. Errors returned by the method are returned as
+// *Error.
+func Call[Req, Resp any](ctx context.Context, c *Client, method string, req Req) (Resp, error) {
+	var resp Resp
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return resp, err
+	}
+	payload, err := c.codec.Marshal(req)
+	if err != nil {
+		return resp, &nanomsg.CodecError{Op: "encode", Codec: c.codec.Name(), Err: err}
+	}
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		// The deadline may pass right after checking the context, but
+		// the timeout must not be zero, which means no deadline.
+		timeout = max(time.Until(deadline), 1)
+	}
+	data := appendRequest(nil, request{method, timeout, MetadataFromContext(ctx)}, payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err = c.conn.Send(data, 0); err != nil {
+		return resp, err
+	}
+	if data, err = c.recv(ctx); err != nil {
+		return resp, err
+	}
+	if payload, err = parseReply(data); err != nil {
+		return resp, err
+	}
+	if err = c.codec.Unmarshal(payload, &resp); err != nil {
+		return resp, &nanomsg.CodecError{Op: "decode", Codec: c.codec.Name(), Err: err}
+	}
+	return resp, nil
+}
+
+// recv receives the reply, giving up when the context is done.
+func (c *Client) recv(ctx context.Context) ([]byte, error) {
+	for {
+		timeout := recvInterval
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); remaining < timeout {
+				timeout = max(remaining, time.Millisecond)
+			}
+		}
+		if err := c.conn.SetRecvTimeout(timeout); err != nil {
+			return nil, err
+		}
+		data, err := c.conn.Recv(0)
+		if err == nil {
+			return data, nil
+		} else if !errors.Is(err, syscall.ETIMEDOUT) {
+			return nil, err
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package rpc implements remote procedure calls over nanomsg REQ/REP sockets.
+//
+// Each request carries the name of the method, the time left until the
+// deadline of the call and metadata in front of the encoded argument. Like the
+// grpc-timeout header, the time left is sent rather than the deadline itself,
+// so the clocks of the client and the server do not have to agree. Replies carry an error code and
+// message in front of the encoded result.
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// version is the version of the framing, sent first in each message.
+const version = 1
+
+// Metadata holds key-value pairs sent along with a request.
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+// WithMetadata returns a context carrying the metadata. Calls made with the
+// context send the metadata to the server.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext returns the metadata of the context. Handlers use it to
+// get the metadata sent by the client.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// Code describes the kind of error of a failed call.
+type Code uint8
+
+const (
+	OK Code = iota
+	// Unknown is used for errors returned by handlers.
+	Unknown
+	// UnknownMethod is returned when the method is not registered.
+	UnknownMethod
+	// InvalidRequest is returned when the request can not be decoded.
+	InvalidRequest
+	// DeadlineExceeded is returned when the deadline of the call has passed.
+	DeadlineExceeded
+	// FlowControl resets a stream when the peer sent more messages than
+	// the window allows.
+	FlowControl
+)
+
+var codeNames = []string{"ok", "unknown", "unknown method", "invalid request", "deadline exceeded", "flow control"}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "Code(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Error is the error returned by a handler, as seen by the client. Handlers
+// can return an *Error to control the code sent to the client.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return "rpc: " + e.Code.String() + ": " + e.Message
+}
+
+// Is makes errors with code DeadlineExceeded match context.DeadlineExceeded.
+func (e *Error) Is(target error) bool {
+	return e.Code == DeadlineExceeded && target == context.DeadlineExceeded
+}
+
+var errFrame = errors.New("rpc: malformed message")
+
+// request is the header of a request. A zero timeout means that the call has
+// no deadline.
+type request struct {
+	method   string
+	timeout  time.Duration
+	metadata Metadata
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+func readString(data []byte) (string, []byte, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return "", nil, errFrame
+	}
+	data = data[size:]
+	return string(data[:n]), data[n:], nil
+}
+
+// appendRequest frames the request header in front of the payload.
+func appendRequest(data []byte, req request, payload []byte) []byte {
+	data = append(data, version)
+	data = appendString(data, req.method)
+	data = binary.BigEndian.AppendUint64(data, uint64(req.timeout))
+	data = binary.AppendUvarint(data, uint64(len(req.metadata)))
+	for k, v := range req.metadata {
+		data = appendString(data, k)
+		data = appendString(data, v)
+	}
+	return append(data, payload...)
+}
+
+// parseRequest splits a message into the request header and the payload.
+func parseRequest(data []byte) (req request, payload []byte, err error) {
+	if len(data) == 0 || data[0] != version {
+		return req, nil, errFrame
+	}
+	if req.method, data, err = readString(data[1:]); err != nil {
+		return req, nil, err
+	}
+	if len(data) < 8 {
+		return req, nil, errFrame
+	}
+	req.timeout = time.Duration(binary.BigEndian.Uint64(data))
+	n, size := binary.Uvarint(data[8:])
+	if size <= 0 {
+		return req, nil, errFrame
+	}
+	data = data[8+size:]
+	for i := uint64(0); i < n; i++ {
+		var k, v string
+		if k, data, err = readString(data); err != nil {
+			return req, nil, err
+		}
+		if v, data, err = readString(data); err != nil {
+			return req, nil, err
+		}
+		if req.metadata == nil {
+			req.metadata = make(Metadata)
+		}
+		req.metadata[k] = v
+	}
+	return req, data, nil
+}
+
+// appendReply frames the error, if any, in front of the payload.
+func appendReply(data []byte, err *Error, payload []byte) []byte {
+	data = append(data, version)
+	if err == nil {
+		data = append(data, byte(OK))
+		return append(data, payload...)
+	}
+	data = append(data, byte(err.Code))
+	return appendString(data, err.Message)
+}
+
+// parseReply splits a message into the error and the payload.
+func parseReply(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != version {
+		return nil, errFrame
+	}
+	if code := Code(data[1]); code != OK {
+		msg, _, err := readString(data[2:])
+		if err != nil {
+			return nil, err
+		}
+		return nil, &Error{code, msg}
+	}
+	return data[2:], nil
+}
@@ -0,0 +1,164 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-nanomsg/nanomsgtest"
+)
+
+func TestFraming(t *testing.T) {
+	sent := request{"Echo", 1500 * time.Millisecond, Metadata{"user": "alice", "trace": "1"}}
+	data := appendRequest(nil, sent, []byte("payload"))
+	received, payload, err := parseRequest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.method != sent.method || received.timeout != sent.timeout || !reflect.DeepEqual(received.metadata, sent.metadata) {
+		t.Errorf("unexpected request: %+v", received)
+	}
+	if string(payload) != "payload" {
+		t.Errorf("unexpected payload: %q", payload)
+	}
+	for i := 0; i < len(data)-len(payload); i++ {
+		if _, _, err = parseRequest(data[:i]); err == nil {
+			t.Errorf("truncated request of %d bytes parsed", i)
+		}
+	}
+
+	if payload, err = parseReply(appendReply(nil, nil, []byte("result"))); err != nil || string(payload) != "result" {
+		t.Errorf("unexpected reply: %q, %v", payload, err)
+	}
+	_, err = parseReply(appendReply(nil, &Error{UnknownMethod, "Nope"}, nil))
+	var rerr *Error
+	if !errors.As(err, &rerr) || rerr.Code != UnknownMethod || rerr.Message != "Nope" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type echoArgs struct {
+	Text  string
+	Sleep time.Duration
+}
+
+func startServer(t *testing.T) *Client {
+	t.Helper()
+	n := nanomsgtest.NewNetwork()
+	rep, req := n.NewSocket(nanomsgtest.REP), n.NewSocket(nanomsgtest.REQ)
+	if err := rep.Bind("rpc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.Connect("rpc"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(nil)
+	Register(server, "Echo", func(ctx context.Context, args echoArgs) (string, error) {
+		if args.Sleep > 0 {
+			select {
+			case <-time.After(args.Sleep):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+		return MetadataFromContext(ctx)["prefix"] + args.Text, nil
+	})
+	Register(server, "Fail", func(ctx context.Context, msg string) (string, error) {
+		return "", errors.New(msg)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Serve(ctx, rep) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("unexpected serve error: %v", err)
+		}
+		req.Close()
+	})
+	return NewClient(req, nil)
+}
+
+func TestCall(t *testing.T) {
+	client := startServer(t)
+	ctx := WithMetadata(context.Background(), Metadata{"prefix": "> "})
+	if resp, err := Call[echoArgs, string](ctx, client, "Echo", echoArgs{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	} else if resp != "> hello" {
+		t.Errorf("unexpected response: %q", resp)
+	}
+
+	_, err := Call[string, string](context.Background(), client, "Fail", "boom")
+	var rerr *Error
+	if !errors.As(err, &rerr) || rerr.Code != Unknown || rerr.Message != "boom" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = Call[string, string](context.Background(), client, "Missing", "")
+	if !errors.As(err, &rerr) || rerr.Code != UnknownMethod {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = Call[int, string](context.Background(), client, "Echo", 42)
+	if !errors.As(err, &rerr) || rerr.Code != InvalidRequest || !strings.Contains(rerr.Message, "json") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	client := startServer(t)
+	client.Timeout = 20 * time.Millisecond
+	_, err := Call[echoArgs, string](context.Background(), client, "Echo", echoArgs{Sleep: time.Second})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The server gives up on the call as well, and serves the next one.
+	client.Timeout = time.Second
+	if resp, err := Call[echoArgs, string](context.Background(), client, "Echo", echoArgs{Text: "again"}); err != nil {
+		t.Fatal(err)
+	} else if resp != "again" {
+		t.Errorf("unexpected response: %q", resp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = Call[echoArgs, string](ctx, client, "Echo", echoArgs{Text: "cancelled"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServerDeadline(t *testing.T) {
+	server := NewServer(nil)
+	var deadline time.Time
+	Register(server, "Deadline", func(ctx context.Context, _ string) (string, error) {
+		deadline, _ = ctx.Deadline()
+		return "", nil
+	})
+	payload := []byte(`""`)
+
+	// The deadline is the timeout from when the server received the
+	// request, whatever the clock of the client says.
+	before := time.Now()
+	if _, err := parseReply(server.handle(context.Background(), appendRequest(nil, request{"Deadline", time.Minute, nil}, payload))); err != nil {
+		t.Fatal(err)
+	}
+	if deadline.Before(before.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("unexpected deadline: %v", deadline)
+	}
+
+	deadline = time.Time{}
+	if _, err := parseReply(server.handle(context.Background(), appendRequest(nil, request{"Deadline", 0, nil}, payload))); err != nil {
+		t.Fatal(err)
+	} else if !deadline.IsZero() {
+		t.Errorf("unexpected deadline: %v", deadline)
+	}
+
+	_, err := parseReply(server.handle(context.Background(), appendRequest(nil, request{"Deadline", -time.Second, nil}, payload)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
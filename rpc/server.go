@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/op/go-nanomsg"
+)
+
+// handler decodes the argument, calls the method and encodes the result.
+type handler func(ctx context.Context, payload []byte) ([]byte, error)
+
+// Server dispatches requests received on a REP socket to the registered
+// methods.
+type Server struct {
+	codec nanomsg.Codec
+
+	mu      sync.RWMutex
+	methods map[string]handler
+}
+
+// NewServer creates a server using the codec to decode arguments and encode
+// results. If codec is nil, nanomsg.JSONCodec is used.
+func NewServer(codec nanomsg.Codec) *Server {
+	if codec == nil {
+		codec = nanomsg.JSONCodec{}
+	}
+	return &Server{codec: codec, methods: make(map[string]handler)}
+}
+
+// Register registers fn as the method with the given name, replacing any
+// method already registered with the name.
+func Register[Req, Resp any](s *Server, method string, fn func(context.Context, Req) (Resp, error)) {
+	codec := s.codec
+	h := func(ctx context.Context, payload []byte) ([]byte, error) {
+		var req Req
+		if err := codec.Unmarshal(payload, &req); err != nil {
+			return nil, &Error{InvalidRequest, err.Error()}
+		}
+		resp, err := fn(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(resp)
+	}
+	s.mu.Lock()
+	s.methods[method] = h
+	s.mu.Unlock()
+}
+
+// Serve receives requests on the socket, which should be a REP socket, and
+// replies to them one at a time. It returns when receiving fails, or when the
+// context is done, in which case the socket is closed to stop receiving.
+func (s *Server) Serve(ctx context.Context, conn nanomsg.Conn) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		data, err := conn.Recv(0)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if _, err = conn.Send(s.handle(ctx, data), 0); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// handle calls the method of the request and returns the reply.
+func (s *Server) handle(ctx context.Context, data []byte) []byte {
+	req, payload, err := parseRequest(data)
+	if err != nil {
+		return appendReply(nil, &Error{InvalidRequest, err.Error()}, nil)
+	}
+	s.mu.RLock()
+	h, exists := s.methods[req.method]
+	s.mu.RUnlock()
+	if !exists {
+		return appendReply(nil, &Error{UnknownMethod, req.method}, nil)
+	}
+
+	if req.metadata != nil {
+		ctx = WithMetadata(ctx, req.metadata)
+	}
+	if req.timeout < 0 {
+		return appendReply(nil, &Error{DeadlineExceeded, req.method}, nil)
+	} else if req.timeout > 0 {
+		// The deadline is relative to when the request was received, as
+		// the clock of the client may differ.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.timeout)
+		defer cancel()
+	}
+
+	result, err := h(ctx, payload)
+	if err != nil {
+		var rerr *Error
+		switch {
+		case errors.As(err, &rerr):
+		case errors.Is(err, context.DeadlineExceeded):
+			rerr = &Error{DeadlineExceeded, err.Error()}
+		default:
+			rerr = &Error{Unknown, err.Error()}
+		}
+		return appendReply(nil, rerr, nil)
+	}
+	return appendReply(nil, nil, result)
+}
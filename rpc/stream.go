@@ -0,0 +1,508 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/op/go-nanomsg"
+)
+
+// Streams are multiplexed over a PAIR socket using frames of the form
+//
+//	version | type | stream id | body
+//
+// where the high bit of the type is set when the sender of the frame opened
+// the stream, which lets both ends open streams without their ids clashing.
+const (
+	frameOpen   = 1 // window, method
+	frameData   = 2 // payload
+	frameCredit = 3 // number of messages the receiver accepts
+	frameClose  = 4 // the sender will not send more data
+	frameReset  = 5 // error code and message, the stream is aborted
+
+	frameOpener = 0x80
+)
+
+// DefaultWindow is the number of messages a stream may have in flight, sent
+// but not yet received by the peer, unless another window is given.
+const DefaultWindow = 16
+
+var (
+	// ErrSessionClosed is returned by streams of a closed session.
+	ErrSessionClosed = errors.New("rpc: session closed")
+	// ErrSendClosed is returned when sending on a stream after CloseSend.
+	ErrSendClosed = errors.New("rpc: send on closed stream")
+)
+
+// StreamHandler handles a stream opened by the peer. Returning nil closes the
+// sending side of the stream, and returning an error resets it.
+type StreamHandler func(ctx context.Context, stream *Stream) error
+
+type streamKey struct {
+	id uint32
+	// local is true for streams opened by this end of the session.
+	local bool
+}
+
+// Session multiplexes bidirectional streams over a socket, usually a PAIR
+// socket. Either end can open streams, which are handled by the handler
+// registered for the method on the other end.
+//
+// Each stream has a window of messages the sender may send before the
+// receiver has received them. The receiver grants more credits as the
+// messages are received, and Send blocks while the sender is out of credits.
+type Session struct {
+	conn   nanomsg.Conn
+	window uint32
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	streams  map[streamKey]*Stream
+	handlers map[string]StreamHandler
+	lastID   uint32
+	err      error
+
+	// control holds the control frames queued by the read loop. They are
+	// sent by writeLoop, so the read loop never blocks on sending while the
+	// peer may be blocked sending to it.
+	control     [][]byte
+	controlWake chan struct{}
+	writerDone  chan struct{}
+}
+
+// NewSession starts a session on the socket. window is the number of messages
+// accepted in flight on each stream, or DefaultWindow if not positive.
+func NewSession(conn nanomsg.Conn, window int) *Session {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		conn:        conn,
+		window:      uint32(window),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		streams:     make(map[streamKey]*Stream),
+		handlers:    make(map[string]StreamHandler),
+		controlWake: make(chan struct{}, 1),
+		writerDone:  make(chan struct{}),
+	}
+	go s.readLoop()
+	go s.writeLoop()
+	return s
+}
+
+// Handle registers the handler for streams opened with the method.
+func (s *Session) Handle(method string, handler StreamHandler) {
+	s.mu.Lock()
+	s.handlers[method] = handler
+	s.mu.Unlock()
+}
+
+// Close closes the socket, failing all streams with ErrSessionClosed.
+func (s *Session) Close() error {
+	err := s.conn.Close()
+	<-s.done
+	<-s.writerDone
+	return err
+}
+
+// Open opens a stream to the handler of the method on the peer.
+func (s *Session) Open(method string) (*Stream, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	st := s.newStream(streamKey{s.nextID(), true}, method)
+	s.streams[st.key] = st
+	s.mu.Unlock()
+
+	body := binary.AppendUvarint(nil, uint64(s.window))
+	if err := st.send(frameOpen, appendString(body, method)); err != nil {
+		st.fail(err)
+		return nil, err
+	}
+	return st, nil
+}
+
+// nextID returns the id for a stream opened by this end. Once the ids have
+// wrapped around, the ids of streams still open are skipped. It is called with
+// the lock held.
+func (s *Session) nextID() uint32 {
+	for {
+		if s.lastID++; s.lastID == 0 {
+			continue
+		}
+		if _, used := s.streams[streamKey{s.lastID, true}]; !used {
+			return s.lastID
+		}
+	}
+}
+
+// newStream creates a stream. It is called with the lock held.
+func (s *Session) newStream(key streamKey, method string) *Stream {
+	ctx, cancel := context.WithCancel(s.ctx)
+	return &Stream{
+		Method:  method,
+		key:     key,
+		session: s,
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}),
+		allowed: s.window,
+	}
+}
+
+// queueControl queues a frame to be sent by writeLoop.
+func (s *Session) queueControl(frame []byte) {
+	s.mu.Lock()
+	s.control = append(s.control, frame)
+	s.mu.Unlock()
+	select {
+	case s.controlWake <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop sends the control frames queued by the read loop until the
+// session is closed. Frames which can not be sent are dropped, as the session
+// fails once the socket does.
+func (s *Session) writeLoop() {
+	defer close(s.writerDone)
+	for {
+		select {
+		case <-s.controlWake:
+		case <-s.ctx.Done():
+			return
+		}
+		s.mu.Lock()
+		frames := s.control
+		s.control = nil
+		s.mu.Unlock()
+		for _, frame := range frames {
+			s.conn.Send(frame, 0)
+		}
+	}
+}
+
+func (s *Session) remove(st *Stream) {
+	s.mu.Lock()
+	if s.streams[st.key] == st {
+		delete(s.streams, st.key)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Session) readLoop() {
+	defer close(s.done)
+	var err error
+	for {
+		var data []byte
+		if data, err = s.conn.Recv(0); err != nil {
+			break
+		}
+		s.handleFrame(data)
+	}
+
+	s.mu.Lock()
+	s.err = ErrSessionClosed
+	streams := s.streams
+	s.streams = nil
+	s.mu.Unlock()
+	s.cancel()
+	for _, st := range streams {
+		st.fail(ErrSessionClosed)
+	}
+}
+
+// handleFrame routes a frame to its stream. Malformed frames and frames for
+// unknown streams are dropped.
+func (s *Session) handleFrame(data []byte) {
+	if len(data) < 6 || data[0] != version {
+		return
+	}
+	typ := data[1] &^ frameOpener
+	// A frame sent by the opener of a stream is for a stream opened remotely.
+	key := streamKey{binary.BigEndian.Uint32(data[2:]), data[1]&frameOpener == 0}
+	body := data[6:]
+
+	if typ == frameOpen {
+		s.accept(key, body)
+		return
+	}
+	s.mu.Lock()
+	st := s.streams[key]
+	s.mu.Unlock()
+	if st == nil {
+		return
+	}
+	switch typ {
+	case frameData:
+		st.deliver(body)
+	case frameCredit:
+		if n, size := binary.Uvarint(body); size > 0 {
+			st.grant(uint32(n))
+		}
+	case frameClose:
+		st.closeRecv()
+	case frameReset:
+		rerr := &Error{Unknown, ""}
+		if len(body) > 0 {
+			rerr.Code = Code(body[0])
+			rerr.Message, _, _ = readString(body[1:])
+		}
+		st.fail(rerr)
+	}
+}
+
+// accept starts the handler for a stream opened by the peer.
+func (s *Session) accept(key streamKey, body []byte) {
+	window, size := binary.Uvarint(body)
+	if size <= 0 {
+		return
+	}
+	method, _, err := readString(body[size:])
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	st := s.newStream(key, method)
+	st.credits = uint32(window)
+	handler, exists := s.handlers[method]
+	if exists {
+		s.streams[key] = st
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		rerr := &Error{UnknownMethod, method}
+		st.fail(rerr)
+		st.sendControl(frameReset, resetBody(rerr))
+		return
+	}
+	st.sendControl(frameCredit, binary.AppendUvarint(nil, uint64(s.window)))
+	go func() {
+		if err := handler(st.ctx, st); err != nil {
+			st.Reset(err)
+		} else {
+			st.CloseSend()
+		}
+	}()
+}
+
+// Stream is a bidirectional stream of messages within a session.
+type Stream struct {
+	// Method is the method the stream was opened with.
+	Method string
+
+	key     streamKey
+	session *Session
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu sync.Mutex
+	// wake is closed and replaced when the state of the stream changes, to
+	// wake up blocked sends and receives.
+	wake    chan struct{}
+	queue   [][]byte
+	credits uint32
+	// allowed is the number of messages the peer has credits to send, and
+	// received the number received since credits were last granted.
+	allowed    uint32
+	received   uint32
+	sendClosed bool
+	recvClosed bool
+	err        error
+}
+
+// Context returns the context of the stream, which is cancelled when the
+// stream is reset or the session is closed.
+func (st *Stream) Context() context.Context {
+	return st.ctx
+}
+
+// frame returns a frame for the stream.
+func (st *Stream) frame(typ byte, body []byte) []byte {
+	if st.key.local {
+		typ |= frameOpener
+	}
+	data := append([]byte{version, typ}, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[2:], st.key.id)
+	return append(data, body...)
+}
+
+// send sends a frame for the stream.
+func (st *Stream) send(typ byte, body []byte) error {
+	_, err := st.session.conn.Send(st.frame(typ, body), 0)
+	return err
+}
+
+// sendControl queues a frame for the stream to be sent by the writer of the
+// session. It is used by the read loop.
+func (st *Stream) sendControl(typ byte, body []byte) {
+	st.session.queueControl(st.frame(typ, body))
+}
+
+func (st *Stream) broadcast() {
+	close(st.wake)
+	st.wake = make(chan struct{})
+}
+
+// Send sends a message on the stream, blocking while the peer has not
+// granted credits for it.
+func (st *Stream) Send(data []byte) error {
+	st.mu.Lock()
+	for st.credits == 0 && st.err == nil && !st.sendClosed {
+		wake := st.wake
+		st.mu.Unlock()
+		<-wake
+		st.mu.Lock()
+	}
+	if st.err != nil {
+		st.mu.Unlock()
+		return st.err
+	} else if st.sendClosed {
+		st.mu.Unlock()
+		return ErrSendClosed
+	}
+	st.credits--
+	st.mu.Unlock()
+	return st.send(frameData, data)
+}
+
+// Recv receives a message from the stream. It returns io.EOF once the peer
+// has closed its sending side and all messages have been received.
+func (st *Stream) Recv() ([]byte, error) {
+	st.mu.Lock()
+	for len(st.queue) == 0 && st.err == nil && !st.recvClosed {
+		wake := st.wake
+		st.mu.Unlock()
+		<-wake
+		st.mu.Lock()
+	}
+	if len(st.queue) == 0 {
+		err := st.err
+		if err == nil {
+			err = io.EOF
+		}
+		st.mu.Unlock()
+		return nil, err
+	}
+	data := st.queue[0]
+	st.queue = st.queue[1:]
+
+	// Grant credits in batches of half the window, to not send a credit
+	// frame for every message.
+	var grant uint32
+	if st.received++; st.received >= (st.session.window+1)/2 && !st.recvClosed {
+		grant, st.received = st.received, 0
+		st.allowed += grant
+	}
+	st.mu.Unlock()
+	if grant > 0 {
+		if err := st.send(frameCredit, binary.AppendUvarint(nil, uint64(grant))); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+// CloseSend closes the sending side of the stream. The peer receives the
+// messages already sent, followed by io.EOF.
+func (st *Stream) CloseSend() error {
+	st.mu.Lock()
+	if st.sendClosed || st.err != nil {
+		st.mu.Unlock()
+		return nil
+	}
+	st.sendClosed = true
+	done := st.recvClosed
+	st.broadcast()
+	st.mu.Unlock()
+	if done {
+		st.finish()
+	}
+	return st.send(frameClose, nil)
+}
+
+// Reset aborts the stream in both directions. The peer fails with an *Error
+// describing err.
+func (st *Stream) Reset(err error) error {
+	rerr, ok := err.(*Error)
+	if !ok {
+		rerr = &Error{Unknown, err.Error()}
+	}
+	st.fail(rerr)
+	return st.send(frameReset, resetBody(rerr))
+}
+
+func resetBody(rerr *Error) []byte {
+	return appendString([]byte{byte(rerr.Code)}, rerr.Message)
+}
+
+// deliver queues a message received on the stream. If the peer sent more
+// messages than it has credits for, the stream is reset.
+func (st *Stream) deliver(data []byte) {
+	st.mu.Lock()
+	if st.recvClosed || st.err != nil {
+		st.mu.Unlock()
+		return
+	} else if st.allowed == 0 {
+		st.mu.Unlock()
+		rerr := &Error{FlowControl, "window exceeded"}
+		st.fail(rerr)
+		st.sendControl(frameReset, resetBody(rerr))
+		return
+	}
+	st.allowed--
+	st.queue = append(st.queue, data)
+	st.broadcast()
+	st.mu.Unlock()
+}
+
+func (st *Stream) grant(n uint32) {
+	st.mu.Lock()
+	st.credits += n
+	st.broadcast()
+	st.mu.Unlock()
+}
+
+func (st *Stream) closeRecv() {
+	st.mu.Lock()
+	st.recvClosed = true
+	done := st.sendClosed
+	st.broadcast()
+	st.mu.Unlock()
+	if done {
+		st.finish()
+	}
+}
+
+// fail aborts the stream with err, unless it has failed already.
+func (st *Stream) fail(err error) {
+	st.mu.Lock()
+	if st.err == nil {
+		st.err = err
+		st.broadcast()
+	}
+	st.mu.Unlock()
+	st.finish()
+}
+
+// finish removes the stream from the session once it is done.
+func (st *Stream) finish() {
+	st.cancel()
+	st.session.remove(st)
+}
@@ -0,0 +1,294 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/op/go-nanomsg"
+	"github.com/op/go-nanomsg/nanomsgtest"
+)
+
+func newSessions(t *testing.T, window int) (*Session, *Session) {
+	t.Helper()
+	n := nanomsgtest.NewNetwork()
+	a, b := n.NewSocket(nanomsgtest.PAIR), n.NewSocket(nanomsgtest.PAIR)
+	if err := a.Bind("stream"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Connect("stream"); err != nil {
+		t.Fatal(err)
+	}
+	client, server := NewSession(a, window), NewSession(b, window)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func echo(ctx context.Context, stream *Stream) error {
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = stream.Send(data); err != nil {
+			return err
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	client, server := newSessions(t, 4)
+	server.Handle("Echo", echo)
+
+	// Both streams are driven from the same goroutine, interleaving their
+	// messages on the socket.
+	streams := make([]*Stream, 2)
+	for i := range streams {
+		var err error
+		if streams[i], err = client.Open("Echo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		for j, stream := range streams {
+			msg := strconv.Itoa(j) + "-" + strconv.Itoa(i)
+			if err := stream.Send([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := stream.Recv(); err != nil {
+				t.Fatal(err)
+			} else if string(data) != msg {
+				t.Errorf("unexpected message: %q != %q", data, msg)
+			}
+		}
+	}
+	for _, stream := range streams {
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+		if err := stream.Send(nil); err != ErrSendClosed {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestStreamFlowControl(t *testing.T) {
+	client, server := newSessions(t, 2)
+	release := make(chan struct{})
+	server.Handle("Slow", func(ctx context.Context, stream *Stream) error {
+		<-release
+		for {
+			if _, err := stream.Recv(); err != nil {
+				return nil
+			}
+		}
+	})
+
+	stream, err := client.Open("Slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = stream.Send([]byte("in window")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sent := make(chan error)
+	go func() { sent <- stream.Send([]byte("blocked")) }()
+	select {
+	case err = <-sent:
+		t.Fatalf("send beyond the window returned: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err = <-sent; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	client, server := newSessions(t, 0)
+	server.Handle("Fail", func(ctx context.Context, stream *Stream) error {
+		return errors.New("boom")
+	})
+
+	var rerr *Error
+	stream, err := client.Open("Missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); !errors.As(err, &rerr) || rerr.Code != UnknownMethod {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if stream, err = client.Open("Fail"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); !errors.As(err, &rerr) || rerr.Message != "boom" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case <-stream.Context().Done():
+	case <-time.After(time.Second):
+		t.Error("context of reset stream not cancelled")
+	}
+
+	server.Handle("Wait", func(ctx context.Context, stream *Stream) error {
+		<-ctx.Done()
+		return nil
+	})
+	if stream, err = client.Open("Wait"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if _, err = stream.Recv(); err != ErrSessionClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err = client.Open("Wait"); err != ErrSessionClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// rawFrame returns a frame as sent by the opener of the stream.
+func rawFrame(typ byte, id uint32, body []byte) []byte {
+	data := append([]byte{version, typ | frameOpener}, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[2:], id)
+	return append(data, body...)
+}
+
+func TestStreamWindowExceeded(t *testing.T) {
+	n := nanomsgtest.NewNetwork()
+	a, peer := n.NewSocket(nanomsgtest.PAIR), n.NewSocket(nanomsgtest.PAIR)
+	defer peer.Close()
+	if err := a.Bind("stream"); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Connect("stream"); err != nil {
+		t.Fatal(err)
+	}
+	session := NewSession(a, 1)
+	defer session.Close()
+	session.Handle("Wait", func(ctx context.Context, stream *Stream) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	// The peer ignores the credits granted and sends two messages with a
+	// window of one.
+	open := appendString(binary.AppendUvarint(nil, 1), "Wait")
+	for _, frame := range [][]byte{rawFrame(frameOpen, 1, open), rawFrame(frameData, 1, nil), rawFrame(frameData, 1, nil)} {
+		if _, err := peer.Send(frame, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, typ := range []byte{frameCredit, frameReset} {
+		data, err := peer.Recv(0)
+		if err != nil {
+			t.Fatal(err)
+		} else if data[1] != typ {
+			t.Fatalf("unexpected frame type %d, expected %d", data[1], typ)
+		} else if typ == frameReset && Code(data[6]) != FlowControl {
+			t.Errorf("unexpected code: %v", Code(data[6]))
+		}
+	}
+}
+
+// blockingConn blocks sending until unblocked.
+type blockingConn struct {
+	nanomsg.Conn
+	unblock chan struct{}
+}
+
+func (c *blockingConn) Send(data []byte, flags int) (int, error) {
+	<-c.unblock
+	return c.Conn.Send(data, flags)
+}
+
+func TestStreamReadWhileSendBlocked(t *testing.T) {
+	n := nanomsgtest.NewNetwork()
+	a, b := n.NewSocket(nanomsgtest.PAIR), n.NewSocket(nanomsgtest.PAIR)
+	if err := a.Bind("stream"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Connect("stream"); err != nil {
+		t.Fatal(err)
+	}
+	conn := &blockingConn{b, make(chan struct{})}
+	// The window is large enough for the handler to not grant credits.
+	client, server := NewSession(a, 8), NewSession(conn, 8)
+	defer client.Close()
+	defer server.Close()
+	defer close(conn.unblock)
+	received := make(chan string)
+	server.Handle("Recv", func(ctx context.Context, stream *Stream) error {
+		for {
+			data, err := stream.Recv()
+			if err != nil {
+				return nil
+			}
+			received <- string(data)
+		}
+	})
+
+	// The server can not send the credits for the stream, or anything else,
+	// but keeps receiving the messages the client has credits for.
+	stream, err := client.Open("Recv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.grant(2)
+	for _, msg := range []string{"one", "two"} {
+		if err = stream.Send([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case data := <-received:
+			if data != msg {
+				t.Errorf("unexpected message: %q != %q", data, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not received while sending is blocked")
+		}
+	}
+}
+
+func TestStreamIDWrap(t *testing.T) {
+	client, server := newSessions(t, 0)
+	server.Handle("Echo", echo)
+
+	first, err := client.Open("Echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.mu.Lock()
+	client.lastID = math.MaxUint32
+	client.mu.Unlock()
+	// Zero is never used, and the first stream is still open.
+	stream, err := client.Open("Echo")
+	if err != nil {
+		t.Fatal(err)
+	} else if first.key.id != 1 || stream.key.id != 2 {
+		t.Errorf("unexpected ids: %d, %d", first.key.id, stream.key.id)
+	}
+	for _, st := range []*Stream{first, stream} {
+		if err = st.Send([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := st.Recv(); err != nil || string(data) != "hello" {
+			t.Errorf("unexpected message: %q, %v", data, err)
+		}
+	}
+}
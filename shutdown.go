@@ -0,0 +1,149 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+// #include <nanomsg/nn.h>
+import "C"
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Term terminates the nanomsg library. All blocking calls on sockets return
+// ETERM, which matches ErrClosed, and any further operations on the sockets
+// fail the same way. Sockets still have to be closed to release them.
+func Term() {
+	C.nn_term()
+}
+
+// ShutdownHandler closes a set of sockets and terminates the library when the
+// process is asked to stop.
+type ShutdownHandler struct {
+	// Linger, if not zero, is set on each socket before it is closed.
+	Linger time.Duration
+	// Timeout is how long the sockets are given to close gracefully before
+	// the library is terminated to force them closed. Default is 5 seconds.
+	Timeout time.Duration
+	// Logger is used to log the shutdown. If nil, nothing is logged.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	sockets []*Socket
+	// term is called to terminate the library, and defaults to Term.
+	term func()
+}
+
+// NewShutdownHandler creates a shutdown handler for the sockets.
+func NewShutdownHandler(sockets ...*Socket) *ShutdownHandler {
+	return &ShutdownHandler{sockets: sockets}
+}
+
+// Register adds sockets to be closed on shutdown.
+func (h *ShutdownHandler) Register(sockets ...*Socket) {
+	h.mu.Lock()
+	h.sockets = append(h.sockets, sockets...)
+	h.mu.Unlock()
+}
+
+func (h *ShutdownHandler) logger() *slog.Logger {
+	return orDiscard(h.Logger)
+}
+
+// Run blocks until the process receives SIGINT or SIGTERM, or until the
+// context is done, and then shuts down. A second signal received while
+// shutting down cuts the graceful close short.
+func (h *ShutdownHandler) Run(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		h.logger().Info("nanomsg: shutting down", "signal", sig.String())
+	case <-ctx.Done():
+		h.logger().Info("nanomsg: shutting down", "error", ctx.Err())
+	}
+
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-signals:
+			h.logger().Warn("nanomsg: forcing shutdown", "signal", sig.String())
+			cancel()
+		case <-shutdownCtx.Done():
+		}
+	}()
+	return h.Shutdown(shutdownCtx)
+}
+
+// Shutdown closes all registered sockets using CloseGracefully and then
+// terminates the library. If the sockets are not closed within Timeout, or
+// before the context is done, the library is terminated right away, which
+// makes the remaining sends fail and the sockets close.
+func (h *ShutdownHandler) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	sockets := h.sockets
+	h.sockets = nil
+	h.mu.Unlock()
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	term := h.term
+	if term == nil {
+		term = Term
+	}
+	// nn_term is not documented to be safe to call twice.
+	var once sync.Once
+	terminate := func() { once.Do(term) }
+
+	errs := make([]error, len(sockets))
+	var wg sync.WaitGroup
+	for i, s := range sockets {
+		wg.Add(1)
+		go func(i int, s *Socket) {
+			defer wg.Done()
+			errs[i] = h.close(ctx, s)
+		}(i, s)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.logger().Warn("nanomsg: sockets not closed in time, terminating")
+		terminate()
+		<-done
+	}
+	terminate()
+	return errors.Join(errs...)
+}
+
+func (h *ShutdownHandler) close(ctx context.Context, s *Socket) error {
+	if h.Linger != 0 {
+		if err := s.SetLinger(h.Linger); err != nil && !errors.Is(err, ErrClosed) {
+			h.logger().Error("nanomsg: failed to set linger", "error", err)
+		}
+	}
+	err := s.CloseGracefully(ctx, nil)
+	// An interrupted close leaves the socket open, see Close, so it is
+	// closed again until it succeeds.
+	for errors.Is(err, syscall.EINTR) {
+		err = s.Close()
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestShutdownHandler(t *testing.T) {
+	pull, err := NewPullSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	push, err := NewPushSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan error)
+	go func() {
+		_, err := push.Send([]byte("nobody listens"), 0)
+		sent <- err
+	}()
+
+	h := NewShutdownHandler(pull.Socket)
+	h.Register(push.Socket)
+	h.Linger = 10 * time.Millisecond
+	h.Timeout = 20 * time.Millisecond
+	terms := 0
+	h.term = func() { terms++ }
+
+	if err = h.Shutdown(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = <-sent; !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected send error: %v", err)
+	}
+	if terms != 1 {
+		t.Errorf("library terminated %d times", terms)
+	}
+	if _, err = pull.Recv(DontWait); !errors.Is(err, ErrClosed) {
+		t.Errorf("socket not closed: %v", err)
+	}
+}
+
+func TestShutdownTerm(t *testing.T) {
+	// Terminating the library can not be undone, so the test runs in a
+	// process of its own.
+	if os.Getenv("NANOMSG_TEST_TERM") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestShutdownTerm$")
+		cmd.Env = append(os.Environ(), "NANOMSG_TEST_TERM=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	pull, err := NewPullSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan error)
+	go func() {
+		_, err := pull.Recv(0)
+		received <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The socket is not registered, so it is only woken up by Term.
+	if err = NewShutdownHandler().Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-received:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("receive not woken up by Term")
+	}
+	if _, err = pull.Recv(DontWait); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
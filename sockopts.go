@@ -0,0 +1,427 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+// #include <nanomsg/reqrep.h>
+// #include <nanomsg/survey.h>
+import "C"
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration which is represented as text, e.g. "250ms", when
+// socket options are read from or written to configuration files.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// SocketOptions holds the configuration of a socket. Options which are nil are
+// left at the nanomsg default. The struct can be loaded from JSON or YAML, and
+// from the environment using LoadEnv.
+//
+// ResendInterval only applies to REQ sockets and Deadline only to SURVEYOR
+// sockets.
+type SocketOptions struct {
+	Linger               *Duration `json:"linger,omitempty" yaml:"linger,omitempty"`
+	SendBuffer           *int64    `json:"send_buffer,omitempty" yaml:"send_buffer,omitempty"`
+	RecvBuffer           *int64    `json:"recv_buffer,omitempty" yaml:"recv_buffer,omitempty"`
+	RecvMaxSize          *int64    `json:"recv_max_size,omitempty" yaml:"recv_max_size,omitempty"`
+	SendTimeout          *Duration `json:"send_timeout,omitempty" yaml:"send_timeout,omitempty"`
+	RecvTimeout          *Duration `json:"recv_timeout,omitempty" yaml:"recv_timeout,omitempty"`
+	ReconnectInterval    *Duration `json:"reconnect_interval,omitempty" yaml:"reconnect_interval,omitempty"`
+	ReconnectIntervalMax *Duration `json:"reconnect_interval_max,omitempty" yaml:"reconnect_interval_max,omitempty"`
+	SendPrio             *int      `json:"send_prio,omitempty" yaml:"send_prio,omitempty"`
+	RecvPrio             *int      `json:"recv_prio,omitempty" yaml:"recv_prio,omitempty"`
+	IPv4Only             *bool     `json:"ipv4_only,omitempty" yaml:"ipv4_only,omitempty"`
+	Name                 *string   `json:"name,omitempty" yaml:"name,omitempty"`
+	TCPNoDelay           *bool     `json:"tcp_nodelay,omitempty" yaml:"tcp_nodelay,omitempty"`
+	ResendInterval       *Duration `json:"resend_interval,omitempty" yaml:"resend_interval,omitempty"`
+	Deadline             *Duration `json:"deadline,omitempty" yaml:"deadline,omitempty"`
+}
+
+// OptionError records which option failed to be applied to a socket.
+type OptionError struct {
+	Name string
+	Err  error
+}
+
+func (e *OptionError) Error() string {
+	return "nanomsg: option " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// LoadEnv sets the options found in the environment. The name of each variable
+// is the prefix followed by the upper cased option name, e.g. with the prefix
+// "APP_" the linger option is read from APP_LINGER.
+func (o *SocketOptions) LoadEnv(prefix string) error {
+	v := reflect.ValueOf(o).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := optionFieldName(v.Type().Field(i))
+		text, exists := os.LookupEnv(prefix + strings.ToUpper(name))
+		if !exists {
+			continue
+		}
+		value := reflect.New(v.Field(i).Type().Elem())
+		if err := parseOptionField(value, text); err != nil {
+			return &OptionError{name, err}
+		}
+		v.Field(i).Set(value)
+	}
+	return nil
+}
+
+// optionFieldName returns the name used for the option in configuration files.
+func optionFieldName(field reflect.StructField) string {
+	name := field.Tag.Get("json")
+	if i := strings.IndexByte(name, ','); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func parseOptionField(value reflect.Value, text string) error {
+	if u, ok := value.Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	elem := value.Elem()
+	switch elem.Kind() {
+	case reflect.String:
+		elem.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		elem.SetBool(b)
+	default:
+		i, err := strconv.ParseInt(text, 10, elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetInt(i)
+	}
+	return nil
+}
+
+// SocketOption configures a socket when it is created.
+type SocketOption func(*SocketOptions)
+
+// WithOptions sets all options which are set in o.
+func WithOptions(o SocketOptions) SocketOption {
+	return func(opts *SocketOptions) {
+		src, dst := reflect.ValueOf(o), reflect.ValueOf(opts).Elem()
+		for i := 0; i < src.NumField(); i++ {
+			if !src.Field(i).IsNil() {
+				dst.Field(i).Set(src.Field(i))
+			}
+		}
+	}
+}
+
+// WithLinger sets the linger option. See SetLinger.
+func WithLinger(linger time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.Linger = durationPtr(linger) }
+}
+
+// WithSendBuffer sets the send buffer size. See SetSendBuffer.
+func WithSendBuffer(size int64) SocketOption {
+	return func(o *SocketOptions) { o.SendBuffer = &size }
+}
+
+// WithRecvBuffer sets the receive buffer size. See SetRecvBuffer.
+func WithRecvBuffer(size int64) SocketOption {
+	return func(o *SocketOptions) { o.RecvBuffer = &size }
+}
+
+// WithRecvMaxSize sets the maximum message size. See SetRecvMaxSize.
+func WithRecvMaxSize(size int64) SocketOption {
+	return func(o *SocketOptions) { o.RecvMaxSize = &size }
+}
+
+// WithSendTimeout sets the send timeout. See SetSendTimeout.
+func WithSendTimeout(timeout time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.SendTimeout = durationPtr(timeout) }
+}
+
+// WithRecvTimeout sets the receive timeout. See SetRecvTimeout.
+func WithRecvTimeout(timeout time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.RecvTimeout = durationPtr(timeout) }
+}
+
+// WithReconnectInterval sets the reconnect interval. See
+// SetReconnectInterval.
+func WithReconnectInterval(interval time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.ReconnectInterval = durationPtr(interval) }
+}
+
+// WithReconnectIntervalMax sets the maximum reconnect interval. See
+// SetReconnectIntervalMax.
+func WithReconnectIntervalMax(interval time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.ReconnectIntervalMax = durationPtr(interval) }
+}
+
+// WithSendPrio sets the sending priority. See SetSendPrio.
+func WithSendPrio(prio int) SocketOption {
+	return func(o *SocketOptions) { o.SendPrio = &prio }
+}
+
+// WithRecvPrio sets the receiving priority. See SetRecvPrio.
+func WithRecvPrio(prio int) SocketOption {
+	return func(o *SocketOptions) { o.RecvPrio = &prio }
+}
+
+// WithIPv4Only sets the IPv4 mode. See SetIPv4Only.
+func WithIPv4Only(onlyIPv4 bool) SocketOption {
+	return func(o *SocketOptions) { o.IPv4Only = &onlyIPv4 }
+}
+
+// WithName sets the socket name. See SetName.
+func WithName(name string) SocketOption {
+	return func(o *SocketOptions) { o.Name = &name }
+}
+
+// WithTCPNoDelay sets the TCP no delay option. See SetTCPNoDelay.
+func WithTCPNoDelay(noDelay bool) SocketOption {
+	return func(o *SocketOptions) { o.TCPNoDelay = &noDelay }
+}
+
+// WithResendInterval sets the resend interval of REQ sockets. See
+// ReqSocket.SetResendInterval.
+func WithResendInterval(interval time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.ResendInterval = durationPtr(interval) }
+}
+
+// WithDeadline sets the survey deadline of SURVEYOR sockets. See
+// SurveyorSocket.SetDeadline.
+func WithDeadline(deadline time.Duration) SocketOption {
+	return func(o *SocketOptions) { o.Deadline = durationPtr(deadline) }
+}
+
+func durationPtr(d time.Duration) *Duration {
+	value := Duration(d)
+	return &value
+}
+
+// SetOptions applies all options which are set in o. Either all of them are
+// applied or none are: the current values are read first, and if an option
+// fails to be applied, the options applied before it are restored. The
+// failing option is reported as an *OptionError.
+func (s *Socket) SetOptions(o SocketOptions) error {
+	before, err := s.Options()
+	if err != nil {
+		return err
+	}
+	if err = s.applyOptions(o); err != nil {
+		if rerr := s.applyOptions(appliedOptions(o, before, err.(*OptionError).Name)); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// appliedOptions returns the values in before of the options set in o which
+// are applied before the named option.
+func appliedOptions(o, before SocketOptions, name string) SocketOptions {
+	var applied SocketOptions
+	ov, bv, av := reflect.ValueOf(o), reflect.ValueOf(before), reflect.ValueOf(&applied).Elem()
+	for i := 0; i < ov.NumField() && optionFieldName(ov.Type().Field(i)) != name; i++ {
+		if !ov.Field(i).IsNil() {
+			av.Field(i).Set(bv.Field(i))
+		}
+	}
+	return applied
+}
+
+// applyOptions applies the options set in o in the order they are declared in
+// SocketOptions, stopping at the first one to fail.
+func (s *Socket) applyOptions(o SocketOptions) error {
+	var err error
+	set := func(name string, f func() error) {
+		if err == nil {
+			if e := f(); e != nil {
+				err = &OptionError{name, e}
+			}
+		}
+	}
+	if o.Linger != nil {
+		set("linger", func() error { return s.SetLinger(time.Duration(*o.Linger)) })
+	}
+	if o.SendBuffer != nil {
+		set("send_buffer", func() error { return s.SetSendBuffer(*o.SendBuffer) })
+	}
+	if o.RecvBuffer != nil {
+		set("recv_buffer", func() error { return s.SetRecvBuffer(*o.RecvBuffer) })
+	}
+	if o.RecvMaxSize != nil {
+		set("recv_max_size", func() error { return s.SetRecvMaxSize(*o.RecvMaxSize) })
+	}
+	if o.SendTimeout != nil {
+		set("send_timeout", func() error { return s.SetSendTimeout(time.Duration(*o.SendTimeout)) })
+	}
+	if o.RecvTimeout != nil {
+		set("recv_timeout", func() error { return s.SetRecvTimeout(time.Duration(*o.RecvTimeout)) })
+	}
+	if o.ReconnectInterval != nil {
+		set("reconnect_interval", func() error { return s.SetReconnectInterval(time.Duration(*o.ReconnectInterval)) })
+	}
+	if o.ReconnectIntervalMax != nil {
+		set("reconnect_interval_max", func() error { return s.SetReconnectIntervalMax(time.Duration(*o.ReconnectIntervalMax)) })
+	}
+	if o.SendPrio != nil {
+		set("send_prio", func() error { return s.SetSendPrio(*o.SendPrio) })
+	}
+	if o.RecvPrio != nil {
+		set("recv_prio", func() error { return s.SetRecvPrio(*o.RecvPrio) })
+	}
+	if o.IPv4Only != nil {
+		set("ipv4_only", func() error { return s.SetIPv4Only(*o.IPv4Only) })
+	}
+	if o.Name != nil {
+		set("name", func() error { return s.SetName(*o.Name) })
+	}
+	if o.TCPNoDelay != nil {
+		set("tcp_nodelay", func() error { return s.SetTCPNoDelay(*o.TCPNoDelay) })
+	}
+	if o.ResendInterval != nil {
+		set("resend_interval", func() error {
+			return s.SetSockOptDuration(C.NN_REQ, C.NN_REQ_RESEND_IVL, time.Millisecond, time.Duration(*o.ResendInterval))
+		})
+	}
+	if o.Deadline != nil {
+		set("deadline", func() error {
+			return s.SetSockOptDuration(C.NN_SURVEYOR, C.NN_SURVEYOR_DEADLINE, time.Millisecond, time.Duration(*o.Deadline))
+		})
+	}
+	return err
+}
+
+// Options reads the current value of all options known to SocketOptions. The
+// protocol specific options are only read for sockets of the matching
+// protocol. If an option can not be read, an *OptionError is returned.
+func (s *Socket) Options() (SocketOptions, error) {
+	var o SocketOptions
+	var err error
+	get := func(name string, f func() error) {
+		if err == nil {
+			if e := f(); e != nil {
+				err = &OptionError{name, e}
+			}
+		}
+	}
+	duration := func(f func() (time.Duration, error)) (*Duration, error) {
+		d, err := f()
+		return durationPtr(d), err
+	}
+	get("linger", func() (err error) { o.Linger, err = duration(s.Linger); return })
+	get("send_buffer", func() error { v, err := s.SendBuffer(); o.SendBuffer = &v; return err })
+	get("recv_buffer", func() error { v, err := s.RecvBuffer(); o.RecvBuffer = &v; return err })
+	get("recv_max_size", func() error { v, err := s.RecvMaxSize(); o.RecvMaxSize = &v; return err })
+	get("send_timeout", func() (err error) { o.SendTimeout, err = duration(s.SendTimeout); return })
+	get("recv_timeout", func() (err error) { o.RecvTimeout, err = duration(s.RecvTimeout); return })
+	get("reconnect_interval", func() (err error) { o.ReconnectInterval, err = duration(s.ReconnectInterval); return })
+	get("reconnect_interval_max", func() (err error) { o.ReconnectIntervalMax, err = duration(s.ReconnectIntervalMax); return })
+	get("send_prio", func() error { v, err := s.SendPrio(); o.SendPrio = &v; return err })
+	get("recv_prio", func() error { v, err := s.RecvPrio(); o.RecvPrio = &v; return err })
+	get("ipv4_only", func() error { v, err := s.IPv4Only(); o.IPv4Only = &v; return err })
+	get("name", func() error { v, err := s.Name(); o.Name = &v; return err })
+	get("tcp_nodelay", func() error { v, err := s.TCPNoDelay(); o.TCPNoDelay = &v; return err })
+
+	var protocol Protocol
+	get("protocol", func() (err error) { protocol, err = s.Protocol(); return })
+	switch protocol {
+	case REQ:
+		get("resend_interval", func() (err error) {
+			o.ResendInterval, err = duration(func() (time.Duration, error) {
+				return s.SockOptDuration(C.NN_REQ, C.NN_REQ_RESEND_IVL, time.Millisecond)
+			})
+			return
+		})
+	case SURVEYOR:
+		get("deadline", func() (err error) {
+			o.Deadline, err = duration(func() (time.Duration, error) {
+				return s.SockOptDuration(C.NN_SURVEYOR, C.NN_SURVEYOR_DEADLINE, time.Millisecond)
+			})
+			return
+		})
+	}
+	if err != nil {
+		return SocketOptions{}, err
+	}
+	return o, nil
+}
+
+// String returns the options which are set, formatted as name=value pairs.
+func (o SocketOptions) String() string {
+	var parts []string
+	v := reflect.ValueOf(o)
+	for i := 0; i < v.NumField(); i++ {
+		if value := optionFieldValue(v.Field(i)); value != nil {
+			parts = append(parts, fmt.Sprintf("%s=%v", optionFieldName(v.Type().Field(i)), value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// OptionDiff describes an option which differs between two SocketOptions. Old
+// and New are nil when the option is not set.
+type OptionDiff struct {
+	Name string
+	Old  interface{}
+	New  interface{}
+}
+
+func (d OptionDiff) String() string {
+	return fmt.Sprintf("%s: %v -> %v", d.Name, d.Old, d.New)
+}
+
+// DiffOptions returns the options which differ between old and new, in the
+// order they are declared in SocketOptions.
+func DiffOptions(old, new SocketOptions) []OptionDiff {
+	var diffs []OptionDiff
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < ov.NumField(); i++ {
+		o, n := optionFieldValue(ov.Field(i)), optionFieldValue(nv.Field(i))
+		if o != n {
+			diffs = append(diffs, OptionDiff{optionFieldName(ov.Type().Field(i)), o, n})
+		}
+	}
+	return diffs
+}
+
+// optionFieldValue returns the value the option field points to, or nil if the
+// option is not set.
+func optionFieldValue(field reflect.Value) interface{} {
+	if field.IsNil() {
+		return nil
+	}
+	return field.Elem().Interface()
+}
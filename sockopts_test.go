@@ -0,0 +1,221 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSocketOptionsJSON(t *testing.T) {
+	var o SocketOptions
+	data := []byte(`{"linger": "250ms", "send_buffer": 4096, "name": "json-sock", "tcp_nodelay": true}`)
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Linger == nil || time.Duration(*o.Linger) != 250*time.Millisecond {
+		t.Errorf("unexpected linger: %v", o.Linger)
+	}
+	if o.SendBuffer == nil || *o.SendBuffer != 4096 {
+		t.Errorf("unexpected send buffer: %v", o.SendBuffer)
+	}
+	if o.Name == nil || *o.Name != "json-sock" {
+		t.Errorf("unexpected name: %v", o.Name)
+	}
+	if o.TCPNoDelay == nil || !*o.TCPNoDelay {
+		t.Errorf("unexpected tcp no delay: %v", o.TCPNoDelay)
+	}
+	if o.RecvBuffer != nil {
+		t.Errorf("unexpected recv buffer: %v", *o.RecvBuffer)
+	}
+}
+
+// TestSocketOptionsYAML checks what YAML libraries rely on without importing
+// one: every field has a yaml tag with the same name as its json tag, and
+// durations are scalars encoded as text.
+func TestSocketOptionsYAML(t *testing.T) {
+	typ := reflect.TypeOf(SocketOptions{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if y, j := field.Tag.Get("yaml"), field.Tag.Get("json"); y == "" || y != j {
+			t.Errorf("%s: yaml tag %q does not match json tag %q", field.Name, y, j)
+		}
+	}
+
+	var d Duration
+	if err := d.UnmarshalText([]byte("250ms")); err != nil {
+		t.Fatal(err)
+	} else if time.Duration(d) != 250*time.Millisecond {
+		t.Errorf("unexpected duration: %v", d)
+	}
+	text, err := d.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Duration
+	if err = back.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	} else if back != d {
+		t.Errorf("unexpected duration after round trip: %v != %v", back, d)
+	}
+	if err = back.UnmarshalText([]byte("soon")); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
+
+func TestSocketOptionsLoadEnv(t *testing.T) {
+	t.Setenv("NNTEST_RECV_TIMEOUT", "1s")
+	t.Setenv("NNTEST_SEND_PRIO", "3")
+	t.Setenv("NNTEST_IPV4_ONLY", "false")
+
+	var o SocketOptions
+	if err := o.LoadEnv("NNTEST_"); err != nil {
+		t.Fatal(err)
+	}
+	if o.RecvTimeout == nil || time.Duration(*o.RecvTimeout) != time.Second {
+		t.Errorf("unexpected recv timeout: %v", o.RecvTimeout)
+	}
+	if o.SendPrio == nil || *o.SendPrio != 3 {
+		t.Errorf("unexpected send prio: %v", o.SendPrio)
+	}
+	if o.IPv4Only == nil || *o.IPv4Only {
+		t.Errorf("unexpected ipv4 only: %v", o.IPv4Only)
+	}
+
+	t.Setenv("NNTEST_SEND_PRIO", "high")
+	if err := o.LoadEnv("NNTEST_"); err == nil {
+		t.Error("expected failure")
+	} else if oerr, ok := err.(*OptionError); !ok || oerr.Name != "send_prio" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewSocketOptions(t *testing.T) {
+	s, err := NewSocket(AF_SP, REQ,
+		WithLinger(64*time.Millisecond),
+		WithRecvTimeout(time.Second),
+		WithName("opts-sock"),
+		WithResendInterval(5*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if linger, err := s.Linger(); err != nil {
+		t.Fatal(err)
+	} else if linger != 64*time.Millisecond {
+		t.Errorf("unexpected linger: %v", linger)
+	}
+	if timeout, err := s.RecvTimeout(); err != nil {
+		t.Fatal(err)
+	} else if timeout != time.Second {
+		t.Errorf("unexpected timeout: %v", timeout)
+	}
+	if name, err := s.Name(); err != nil {
+		t.Fatal(err)
+	} else if name != "opts-sock" {
+		t.Errorf("unexpected name: %s", name)
+	}
+
+	// Deadline is a SURVEYOR option and can not be applied to a REQ socket.
+	_, err = NewReqSocket(WithLinger(time.Second), WithDeadline(time.Second))
+	if oerr, ok := err.(*OptionError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	} else if oerr.Name != "deadline" || !errors.Is(oerr.Err, syscall.ENOPROTOOPT) {
+		t.Errorf("unexpected error: %v", oerr)
+	}
+}
+
+func TestSetOptionsRollback(t *testing.T) {
+	s, err := NewSocket(AF_SP, REQ, WithLinger(10*time.Millisecond), WithName("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	before, err := s.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deadline fails on a REQ socket, after linger and name have been applied.
+	err = s.SetOptions(SocketOptions{
+		Linger:   durationPtr(time.Second),
+		Name:     &[]string{"after"}[0],
+		Deadline: durationPtr(time.Second),
+	})
+	if oerr, ok := err.(*OptionError); !ok || oerr.Name != "deadline" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := s.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := DiffOptions(before, after); len(diffs) != 0 {
+		t.Errorf("options not rolled back: %v", diffs)
+	}
+}
+
+func TestSocketOptionsSnapshot(t *testing.T) {
+	s, err := NewSurveyorSocket(WithName("snap-sock"), WithDeadline(3*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	before, err := s.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Name == nil || *before.Name != "snap-sock" {
+		t.Errorf("unexpected name: %v", before.Name)
+	}
+	if before.Deadline == nil || time.Duration(*before.Deadline) != 3*time.Second {
+		t.Errorf("unexpected deadline: %v", before.Deadline)
+	}
+	if before.ResendInterval != nil {
+		t.Errorf("unexpected resend interval: %v", *before.ResendInterval)
+	}
+
+	if err = s.SetLinger(42 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	after, err := s.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs := DiffOptions(before, after)
+	if len(diffs) != 1 {
+		t.Fatalf("unexpected diffs: %v", diffs)
+	}
+	if diffs[0].Name != "linger" || diffs[0].New != Duration(42*time.Millisecond) {
+		t.Errorf("unexpected diff: %v", diffs[0])
+	}
+}
+
+func TestDiffOptions(t *testing.T) {
+	var a, b SocketOptions
+	WithOptions(SocketOptions{})(&a)
+	WithSendPrio(2)(&a)
+	WithName("a")(&a)
+	WithName("a")(&b)
+	WithTCPNoDelay(true)(&b)
+
+	diffs := DiffOptions(a, b)
+	if len(diffs) != 2 {
+		t.Fatalf("unexpected diffs: %v", diffs)
+	}
+	if s := diffs[0].String(); s != "send_prio: 2 -> <nil>" {
+		t.Errorf("unexpected diff: %s", s)
+	}
+	if s := diffs[1].String(); s != "tcp_nodelay: <nil> -> true" {
+		t.Errorf("unexpected diff: %s", s)
+	}
+	if s := b.String(); s != "name=a tcp_nodelay=true" {
+		t.Errorf("unexpected options: %s", s)
+	}
+}
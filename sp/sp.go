@@ -0,0 +1,96 @@
+// Package sp defines the socket interfaces and errors of the nanomsg package
+// without depending on the nanomsg C library. SP stands for the scalability
+// protocols implemented by nanomsg.
+//
+// The nanomsg package exposes the same types and values under the same names,
+// so code which only uses these can accept both nanomsg sockets and the
+// in-memory sockets of the nanomsgtest package, and be tested without cgo.
+package sp
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"syscall"
+)
+
+// DontWait makes Send and Recv fail with EAGAIN instead of blocking. It has
+// the same value as NN_DONTWAIT.
+const DontWait = 1
+
+// Sender is implemented by sockets which messages can be sent on.
+type Sender interface {
+	Send(data []byte, flags int) (int, error)
+}
+
+// Receiver is implemented by sockets which messages can be received from.
+type Receiver interface {
+	Recv(flags int) ([]byte, error)
+}
+
+// Conn is a socket which messages can be sent on and received from.
+type Conn interface {
+	Sender
+	Receiver
+	io.Closer
+}
+
+// Errno is an error specific to nanomsg, which has no counterpart in syscall.
+type Errno syscall.Errno
+
+// hausnumero is NN_HAUSNUMERO, the base of the nanomsg specific errors.
+const hausnumero = 156384712
+
+const (
+	// ETERM is returned once the library has been terminated.
+	ETERM = Errno(hausnumero + 53)
+	// EFSM is returned when the operation can not be performed in the
+	// current state of the socket, e.g. receiving on a REQ socket before
+	// sending a request.
+	EFSM = Errno(hausnumero + 54)
+)
+
+var errnoStrings = map[Errno]string{
+	ETERM: "Nanomsg library was terminated",
+	EFSM:  "Operation cannot be performed in this state",
+}
+
+func (e Errno) Error() string {
+	if s, exists := errnoStrings[e]; exists {
+		return s
+	}
+	return "errno " + strconv.Itoa(int(e))
+}
+
+// These errors are matched by errors.Is for the errors returned by operations
+// on sockets, making it possible to handle them the same way regardless of
+// which operation or socket type they came from.
+var (
+	// ErrTimeout is matched when an operation did not complete in time; a
+	// send or receive timeout or an expired survey deadline.
+	ErrTimeout = errors.New("nanomsg: timeout")
+	// ErrWouldBlock is matched when an operation using DontWait could not
+	// be performed straight away.
+	ErrWouldBlock = errors.New("nanomsg: operation would block")
+	// ErrSurveyExpired is matched when the deadline of a survey expired
+	// while receiving responses on a SURVEYOR socket.
+	ErrSurveyExpired = errors.New("nanomsg: survey expired")
+	// ErrClosed is matched when the socket, or the library, is closed.
+	ErrClosed = errors.New("nanomsg: socket closed")
+)
+
+// MatchErrno returns true if err, the error of a failed operation, matches
+// target, which is one of ErrTimeout, ErrWouldBlock and ErrClosed. It is used
+// by the error types of socket implementations to match the errors above.
+// ErrSurveyExpired depends on the operation and protocol, and is not matched.
+func MatchErrno(err, target error) bool {
+	switch target {
+	case ErrTimeout:
+		return errors.Is(err, syscall.ETIMEDOUT)
+	case ErrWouldBlock:
+		return errors.Is(err, syscall.EAGAIN)
+	case ErrClosed:
+		return errors.Is(err, syscall.EBADF) || errors.Is(err, ETERM)
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package sp
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestMatchErrno(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		target error
+	}{
+		{syscall.ETIMEDOUT, ErrTimeout},
+		{syscall.EAGAIN, ErrWouldBlock},
+		{syscall.EBADF, ErrClosed},
+		{fmt.Errorf("wrapped: %w", ETERM), ErrClosed},
+	} {
+		for _, target := range []error{ErrTimeout, ErrWouldBlock, ErrClosed, ErrSurveyExpired} {
+			if MatchErrno(test.err, target) != (target == test.target) {
+				t.Errorf("%v: unexpected match for %v", test.err, target)
+			}
+		}
+	}
+	if !errors.Is(fmt.Errorf("wrapped: %w", EFSM), EFSM) || EFSM.Error() != "Operation cannot be performed in this state" {
+		t.Errorf("unexpected EFSM: %v", EFSM)
+	}
+}
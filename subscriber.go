@@ -0,0 +1,135 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// DefaultTopicDelimiter separates the topic from the payload of a message,
+// unless another delimiter is given.
+const DefaultTopicDelimiter = "\x00"
+
+// SubscriberConn is the socket used by a Subscriber. It is implemented by
+// SubSocket.
+type SubscriberConn interface {
+	Receiver
+	io.Closer
+	Subscribe(topic string) error
+	Unsubscribe(topic string) error
+	// TopicDelimiter returns the delimiter separating the topic from the
+	// payload of a message.
+	TopicDelimiter() string
+}
+
+var _ SubscriberConn = (*SubSocket)(nil)
+
+// TopicHandler handles a message received on a topic.
+type TopicHandler func(topic string, payload []byte)
+
+// Subscriber dispatches messages to handlers based on their topic. Messages
+// consist of the topic, the delimiter of the socket and the payload, as sent
+// by PubSocket.Publish.
+//
+// Handlers are registered for prefixes, which are matched against the topic
+// and delimiter at the start of each message the same way nanomsg filters
+// subscriptions. A prefix thus matches all topics starting with it, and a
+// prefix ending with the delimiter matches a single topic. Each message is
+// handled by the handler with the longest matching prefix.
+type Subscriber struct {
+	conn SubscriberConn
+
+	mu       sync.RWMutex
+	handlers map[string]TopicHandler
+}
+
+// NewSubscriber creates a subscriber receiving messages on the socket. The
+// topic of each message ends at the delimiter returned by the TopicDelimiter
+// method of the socket, see SubSocket.SetTopicDelimiter.
+func NewSubscriber(conn SubscriberConn) *Subscriber {
+	return &Subscriber{
+		conn:     conn,
+		handlers: make(map[string]TopicHandler),
+	}
+}
+
+// Handle registers the handler for messages starting with prefix, subscribing
+// the socket to it. A handler already registered for the prefix is replaced.
+func (s *Subscriber) Handle(prefix string, handler TopicHandler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.handlers[prefix]; !exists {
+		if err := s.conn.Subscribe(prefix); err != nil {
+			return err
+		}
+	}
+	s.handlers[prefix] = handler
+	return nil
+}
+
+// Remove removes the handler for prefix, unsubscribing the socket from it.
+func (s *Subscriber) Remove(prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.handlers[prefix]; !exists {
+		return nil
+	}
+	if err := s.conn.Unsubscribe(prefix); err != nil {
+		return err
+	}
+	delete(s.handlers, prefix)
+	return nil
+}
+
+// Run receives messages and dispatches them to the handlers until receiving
+// fails, or until the context is done, in which case the socket is closed to
+// stop receiving.
+func (s *Subscriber) Run(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		data, err := s.conn.Recv(0)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		s.Dispatch(data)
+	}
+}
+
+// Dispatch calls the handler matching the message. It returns false if no
+// handler matched, which happens when the handler is removed while the
+// message is in flight.
+func (s *Subscriber) Dispatch(msg []byte) bool {
+	delimiter := s.conn.TopicDelimiter()
+	topic, payload, end := msg, []byte(nil), len(msg)
+	if i := bytes.Index(msg, []byte(delimiter)); i >= 0 {
+		end = i + len(delimiter)
+		topic, payload = msg[:i], msg[end:]
+	}
+
+	s.mu.RLock()
+	var handler TopicHandler
+	for i := end; i >= 0 && handler == nil; i-- {
+		handler = s.handlers[string(msg[:i])]
+	}
+	s.mu.RUnlock()
+	if handler == nil {
+		return false
+	}
+	handler(string(topic), payload)
+	return true
+}
@@ -0,0 +1,113 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/op/go-nanomsg/nanomsgtest"
+)
+
+// delimitedSocket is an in-memory SUB socket with a topic delimiter.
+type delimitedSocket struct {
+	*nanomsgtest.Socket
+	delimiter string
+}
+
+func (s delimitedSocket) TopicDelimiter() string {
+	return s.delimiter
+}
+
+func TestSubscriber(t *testing.T) {
+	n := nanomsgtest.NewNetwork()
+	pub, sub := n.NewSocket(nanomsgtest.PUB), n.NewSocket(nanomsgtest.SUB)
+	defer pub.Close()
+	if err := pub.Bind("topics"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Connect("topics"); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan string, 10)
+	record := func(name string) TopicHandler {
+		return func(topic string, payload []byte) {
+			received <- name + " " + topic + " " + string(payload)
+		}
+	}
+	s := NewSubscriber(delimitedSocket{sub, "|"})
+	for prefix, name := range map[string]string{
+		"order":     "prefix",
+		"orders.eu": "region",
+		"order|":    "exact",
+		"audit":     "removed",
+	} {
+		if err := s.Handle(prefix, record(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Remove("audit"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	for _, msg := range []string{"audit|skipped", "order|1", "orders|2", "orders.eu|3", "orders.eu.north|4", "orderly"} {
+		if _, err := pub.Send([]byte(msg), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []string{
+		"exact order 1",
+		"prefix orders 2",
+		"region orders.eu 3",
+		"region orders.eu.north 4",
+		"prefix orderly ",
+	} {
+		if msg := <-received; msg != expected {
+			t.Errorf("unexpected dispatch: %q != %q", msg, expected)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubscriberTopicDelimiter(t *testing.T) {
+	sub, err := NewSubSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if err = sub.SetTopicDelimiter("|"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The delimiter of the socket is used, also when set after creating the
+	// subscriber.
+	var topics []string
+	s := NewSubscriber(sub)
+	if err = s.Handle("order|", func(topic string, payload []byte) {
+		topics = append(topics, topic)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Dispatch([]byte("order|1")) {
+		t.Error("order|1 not dispatched")
+	}
+	if err = sub.SetTopicDelimiter(":"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Dispatch([]byte("order|:2")) {
+		t.Error("order|:2 not dispatched")
+	}
+	if !slices.Equal(topics, []string{"order", "order|"}) {
+		t.Errorf("unexpected topics: %q", topics)
+	}
+}
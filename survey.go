@@ -22,9 +22,10 @@ type SurveyorSocket struct {
 // The survey is delivered to all the connected respondents. Once
 // the query is sent, the socket can be used to receive the
 // responses. When the survey deadline expires, receive will
-// return ETIMEDOUT error.
-func NewSurveyorSocket() (*SurveyorSocket, error) {
-	socket, err := NewSocket(AF_SP, SURVEYOR)
+// return ETIMEDOUT error, which matches both ErrSurveyExpired and
+// ErrTimeout.
+func NewSurveyorSocket(opts ...SocketOption) (*SurveyorSocket, error) {
+	socket, err := NewSocket(AF_SP, SURVEYOR, opts...)
 	return &SurveyorSocket{socket}, err
 }
 
@@ -34,7 +35,7 @@ func (s *SurveyorSocket) Deadline() (time.Duration, error) {
 }
 
 // SetDeadline specifies how long to wait for responses to the survey. Once
-// the deadline expires, receive function will return ETIMEDOUT error and
+// the deadline expires, receive function will return ErrSurveyExpired and
 // all subsequent responses to the survey will be silently dropped.
 func (s *SurveyorSocket) SetDeadline(deadline time.Duration) error {
 	return s.Socket.SetSockOptDuration(C.NN_SURVEYOR, C.NN_SURVEYOR_DEADLINE, time.Millisecond, deadline)
@@ -47,7 +48,7 @@ type RespondentSocket struct {
 // NewRespondentSocket creates a respondent socket used to respond to the
 // survey. Survey is received using receive function, response is sent
 // using send function. This socket can be connected to at most one peer.
-func NewRespondentSocket() (*RespondentSocket, error) {
-	socket, err := NewSocket(AF_SP, RESPONDENT)
+func NewRespondentSocket(opts ...SocketOption) (*RespondentSocket, error) {
+	socket, err := NewSocket(AF_SP, RESPONDENT, opts...)
 	return &RespondentSocket{socket}, err
 }
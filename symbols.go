@@ -5,7 +5,23 @@ package nanomsg
 // #include <nanomsg/nn.h>
 import "C"
 
-var symbols = make(map[string]int)
+import (
+	"unsafe"
+)
+
+// symbolInfo holds the properties nanomsg exposes for each of its symbols.
+type symbolInfo struct {
+	name      string
+	value     int
+	namespace int
+	typ       int
+	unit      int
+}
+
+var (
+	symbols     = make(map[string]int)
+	symbolInfos []symbolInfo
+)
 
 // Symbol returns the integer value for the given symbol.
 func symbol(name string) (int, bool) {
@@ -13,13 +29,32 @@ func symbol(name string) (int, bool) {
 	return value, exists
 }
 
+// symbolName returns the name of the symbol with the value in the namespace.
+func symbolName(namespace, value int) (string, bool) {
+	for _, info := range symbolInfos {
+		if info.namespace == namespace && info.value == value {
+			return info.name, true
+		}
+	}
+	return "", false
+}
+
 func init() {
-	var value C.int
+	var props C.struct_nn_symbol_properties
+	size := C.int(unsafe.Sizeof(props))
 	for i := 0; ; i++ {
-		name, _ := C.nn_symbol(C.int(i), &value)
-		if name == nil {
+		if rc := C.nn_symbol_info(C.int(i), &props, size); rc == 0 {
 			break
 		}
-		symbols[C.GoString(name)] = int(value)
+		info := symbolInfo{
+			name:      C.GoString(props.name),
+			value:     int(props.value),
+			namespace: int(props.ns),
+			typ:       int(props._type),
+			unit:      int(props.unit),
+		}
+		symbols[info.name] = info.value
+		symbolInfos = append(symbolInfos, info)
 	}
+	registerOptions(symbolInfos)
 }
@@ -0,0 +1,120 @@
+// Package trace propagates W3C trace context in nanomsg messages.
+//
+// The trace context is carried in an envelope in front of the payload. The
+// wrappers in this package add and remove the envelope, and create spans for
+// each message using a pluggable Tracer.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// SpanContext is the W3C trace context of a span.
+type SpanContext struct {
+	// TraceParent is the traceparent header, in the form
+	// version-traceid-parentid-flags.
+	TraceParent string
+	// TraceState is the tracestate header with vendor specific data.
+	TraceState string
+}
+
+// IsValid returns true if the trace parent is well formed.
+func (sc SpanContext) IsValid() bool {
+	parts := strings.Split(sc.TraceParent, "-")
+	if len(parts) < 4 || (parts[0] == "00" && len(parts) != 4) {
+		return false
+	}
+	for i, size := range []int{2, 32, 16, 2} {
+		if len(parts[i]) != size || strings.Trim(parts[i], "0123456789abcdef") != "" {
+			return false
+		}
+	}
+	// Version ff, and all zero trace and parent ids are invalid.
+	return parts[0] != "ff" &&
+		strings.Trim(parts[1], "0") != "" &&
+		strings.Trim(parts[2], "0") != ""
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying the span context.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// The envelope starts with a magic and a version, followed by the length
+// prefixed traceparent and tracestate and finally the payload:
+//
+//	"NNTC" | version (1) | len (1) | traceparent | len (2) | tracestate | payload
+const (
+	magic         = "NNTC"
+	version       = 1
+	headerSize    = len(magic) + 1 + 1 + 2
+	maxTraceState = 1<<16 - 1
+)
+
+// ErrNoEnvelope is returned by Open when the message has no trace envelope.
+var ErrNoEnvelope = errors.New("trace: message has no trace envelope")
+
+// Inject returns the message wrapped in an envelope carrying the span context
+// found in ctx. If there is no valid span context, the envelope is empty.
+func Inject(ctx context.Context, msg []byte) []byte {
+	sc, _ := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		sc = SpanContext{}
+	}
+	if len(sc.TraceState) > maxTraceState {
+		sc.TraceState = ""
+	}
+	buf := make([]byte, 0, headerSize+len(sc.TraceParent)+len(sc.TraceState)+len(msg))
+	buf = append(buf, magic...)
+	buf = append(buf, version, byte(len(sc.TraceParent)))
+	buf = append(buf, sc.TraceParent...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(sc.TraceState)))
+	buf = append(buf, sc.TraceState...)
+	return append(buf, msg...)
+}
+
+// Open removes the envelope from the message, returning the span context and
+// the payload. If the message has no envelope, ErrNoEnvelope is returned.
+func Open(msg []byte) (SpanContext, []byte, error) {
+	var sc SpanContext
+	if len(msg) < headerSize || string(msg[:len(magic)]) != magic || msg[len(magic)] != version {
+		return sc, msg, ErrNoEnvelope
+	}
+	rest := msg[len(magic)+1:]
+	n := int(rest[0])
+	if len(rest) < 1+n+2 {
+		return sc, msg, ErrNoEnvelope
+	}
+	sc.TraceParent, rest = string(rest[1:1+n]), rest[1+n:]
+	n = int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+n {
+		return SpanContext{}, msg, ErrNoEnvelope
+	}
+	sc.TraceState, rest = string(rest[2:2+n]), rest[2+n:]
+	return sc, rest, nil
+}
+
+// Extract removes the envelope from the message and returns a copy of ctx
+// carrying the span context found in it, together with the payload. Messages
+// without an envelope are returned as they are, with ctx unchanged.
+func Extract(ctx context.Context, msg []byte) (context.Context, []byte) {
+	sc, payload, err := Open(msg)
+	if err != nil {
+		return ctx, msg
+	}
+	if sc.IsValid() {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+	return ctx, payload
+}
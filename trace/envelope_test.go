@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestSpanContextIsValid(t *testing.T) {
+	var tests = []struct {
+		traceParent string
+		valid       bool
+	}{
+		{traceParent, true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+	}
+	for _, test := range tests {
+		if valid := (SpanContext{TraceParent: test.traceParent}).IsValid(); valid != test.valid {
+			t.Errorf("%q: expected valid=%v", test.traceParent, test.valid)
+		}
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	sc := SpanContext{traceParent, "vendor=value"}
+	ctx := ContextWithSpanContext(context.Background(), sc)
+	msg := Inject(ctx, []byte("payload"))
+
+	ctx, payload := Extract(context.Background(), msg)
+	if !bytes.Equal(payload, []byte("payload")) {
+		t.Errorf("unexpected payload: %q", payload)
+	}
+	if got, ok := SpanContextFromContext(ctx); !ok || got != sc {
+		t.Errorf("unexpected span context: %+v", got)
+	}
+
+	// Messages sent without a span context still get an envelope.
+	msg = Inject(context.Background(), []byte("payload"))
+	if sc, payload, err := Open(msg); err != nil {
+		t.Fatal(err)
+	} else if sc != (SpanContext{}) || !bytes.Equal(payload, []byte("payload")) {
+		t.Errorf("unexpected envelope: %+v %q", sc, payload)
+	}
+
+	// Messages without an envelope are passed through.
+	for _, raw := range []string{"", "payload", "NNTC\x01\x40short"} {
+		ctx, payload := Extract(context.Background(), []byte(raw))
+		if string(payload) != raw {
+			t.Errorf("unexpected payload: %q", payload)
+		}
+		if _, ok := SpanContextFromContext(ctx); ok {
+			t.Errorf("%q: unexpected span context", raw)
+		}
+	}
+}
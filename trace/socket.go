@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/op/go-nanomsg"
+)
+
+func tracerOrNop(tracer Tracer) Tracer {
+	if tracer == nil {
+		return NopTracer{}
+	}
+	return tracer
+}
+
+// ReqSocket wraps a REQ socket, creating a client span for each request.
+type ReqSocket struct {
+	*nanomsg.ReqSocket
+	tracer Tracer
+}
+
+// NewReqSocket wraps the socket. If tracer is nil, no spans are created.
+func NewReqSocket(socket *nanomsg.ReqSocket, tracer Tracer) *ReqSocket {
+	return &ReqSocket{socket, tracerOrNop(tracer)}
+}
+
+// Request sends the request, carrying the trace context, and waits for the
+// reply.
+func (r *ReqSocket) Request(ctx context.Context, req []byte) (rep []byte, err error) {
+	ctx, span := r.tracer.Start(ctx, "nanomsg.request", SpanKindClient)
+	defer func() { span.End(err) }()
+
+	if _, err = r.Send(Inject(ctx, req), 0); err != nil {
+		return nil, err
+	}
+	if rep, err = r.Recv(0); err != nil {
+		return nil, err
+	}
+	_, rep = Extract(ctx, rep)
+	return rep, nil
+}
+
+// RepSocket wraps a REP socket, creating a server span for each request.
+type RepSocket struct {
+	*nanomsg.RepSocket
+	tracer Tracer
+}
+
+// NewRepSocket wraps the socket. If tracer is nil, no spans are created.
+func NewRepSocket(socket *nanomsg.RepSocket, tracer Tracer) *RepSocket {
+	return &RepSocket{socket, tracerOrNop(tracer)}
+}
+
+type spanKey struct{}
+
+// RecvContext receives a request. The returned context is derived from ctx and
+// carries the trace context of the request and the server span. The span ends
+// when the context is passed to Reply.
+func (r *RepSocket) RecvContext(ctx context.Context) (context.Context, []byte, error) {
+	req, err := r.Recv(0)
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx, req = Extract(ctx, req)
+	ctx, span := r.tracer.Start(ctx, "nanomsg.reply", SpanKindServer)
+	return context.WithValue(ctx, spanKey{}, span), req, nil
+}
+
+// Reply sends the reply to the request received with RecvContext, and ends
+// its span.
+func (r *RepSocket) Reply(ctx context.Context, rep []byte) error {
+	_, err := r.Send(Inject(ctx, rep), 0)
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		span.End(err)
+	}
+	return err
+}
+
+// PushSocket wraps a PUSH socket, creating a producer span for each message.
+type PushSocket struct {
+	*nanomsg.PushSocket
+	tracer Tracer
+}
+
+// NewPushSocket wraps the socket. If tracer is nil, no spans are created.
+func NewPushSocket(socket *nanomsg.PushSocket, tracer Tracer) *PushSocket {
+	return &PushSocket{socket, tracerOrNop(tracer)}
+}
+
+// SendContext sends the message carrying the trace context.
+func (p *PushSocket) SendContext(ctx context.Context, msg []byte) (err error) {
+	ctx, span := p.tracer.Start(ctx, "nanomsg.push", SpanKindProducer)
+	defer func() { span.End(err) }()
+	_, err = p.Send(Inject(ctx, msg), 0)
+	return err
+}
+
+// PullSocket wraps a PULL socket, creating a consumer span for each message.
+type PullSocket struct {
+	*nanomsg.PullSocket
+	tracer Tracer
+}
+
+// NewPullSocket wraps the socket. If tracer is nil, no spans are created.
+func NewPullSocket(socket *nanomsg.PullSocket, tracer Tracer) *PullSocket {
+	return &PullSocket{socket, tracerOrNop(tracer)}
+}
+
+// RecvContext receives a message. The returned context is derived from ctx
+// and carries the trace context of the consumer span, which has ended by the
+// time the message is returned.
+func (p *PullSocket) RecvContext(ctx context.Context) (context.Context, []byte, error) {
+	msg, err := p.Recv(0)
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx, msg = Extract(ctx, msg)
+	ctx, span := p.tracer.Start(ctx, "nanomsg.pull", SpanKindConsumer)
+	span.End(nil)
+	return ctx, msg, nil
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/op/go-nanomsg"
+)
+
+// recordingTracer records the spans started, giving each a new span id.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+type recordedSpan struct{}
+
+func (recordedSpan) End(err error) {}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parent, _ := SpanContextFromContext(ctx)
+	r.spans = append(r.spans, name+" "+parent.TraceParent)
+	sc := SpanContext{TraceParent: fmt.Sprintf("00-4bf92f3577b34da6a3ce929d0e0e4736-%016x-01", len(r.spans))}
+	return ContextWithSpanContext(ctx, sc), recordedSpan{}
+}
+
+func TestReqRep(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	rep, err := nanomsg.NewRepSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rep.Close()
+	if _, err = rep.Bind("inproc://trace"); err != nil {
+		t.Fatal(err)
+	}
+	req, err := nanomsg.NewReqSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer req.Close()
+	if _, err = req.Connect("inproc://trace"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewRepSocket(rep, tracer)
+	done := make(chan error)
+	go func() {
+		ctx, data, err := server.RecvContext(context.Background())
+		if err == nil {
+			err = server.Reply(ctx, append(data, '!'))
+		}
+		done <- err
+	}()
+
+	client := NewReqSocket(req, tracer)
+	reply, err := client.Request(context.Background(), []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "hello!" {
+		t.Errorf("unexpected reply: %s", reply)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"nanomsg.request ",
+		"nanomsg.reply 00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000001-01",
+	}
+	if fmt.Sprint(tracer.spans) != fmt.Sprint(expected) {
+		t.Errorf("unexpected spans: %q", tracer.spans)
+	}
+}
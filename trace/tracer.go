@@ -0,0 +1,45 @@
+package trace
+
+import (
+	"context"
+)
+
+// SpanKind describes the role of a span in the message exchange.
+type SpanKind int
+
+const (
+	// SpanKindClient is used for requests sent on a REQ socket.
+	SpanKindClient SpanKind = iota
+	// SpanKindServer is used for requests received on a REP socket.
+	SpanKindServer
+	// SpanKindProducer is used for messages sent on a PUSH socket.
+	SpanKindProducer
+	// SpanKindConsumer is used for messages received on a PULL socket.
+	SpanKindConsumer
+)
+
+// Tracer creates spans. Implementations adapt this to a tracing library.
+type Tracer interface {
+	// Start starts a span as a child of the span context found in ctx, if
+	// any. The returned context must carry the span context of the new span,
+	// using ContextWithSpanContext, for it to be propagated.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span. err is the error the operation failed with, if any.
+	End(err error)
+}
+
+// NopTracer is a Tracer which does not create any spans. The span context of
+// incoming messages is still propagated.
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(err error) {}
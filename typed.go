@@ -0,0 +1,199 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Codec encodes values into messages and decodes messages into values.
+type Codec interface {
+	// Name is the name of the codec, used in errors.
+	Name() string
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes the message into the value pointed to by v.
+	Unmarshal(data []byte, v any) error
+}
+
+// AppendCodec is implemented by codecs which can encode values into an
+// existing buffer. TypedSocket reuses its buffers when sending with such a
+// codec.
+type AppendCodec interface {
+	Codec
+	// AppendMarshal appends the encoded value to dst and returns the
+	// extended buffer.
+	AppendMarshal(dst []byte, v any) ([]byte, error)
+}
+
+// CodecError is returned when a value can not be encoded or a message can not
+// be decoded.
+type CodecError struct {
+	// Op is either "encode" or "decode".
+	Op    string
+	Codec string
+	Err   error
+}
+
+func (e *CodecError) Error() string {
+	return "nanomsg: " + e.Codec + " " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+// TypedSocket sends and receives values of type T, using the codec to turn
+// them into messages.
+type TypedSocket[T any] struct {
+	Conn  Conn
+	Codec Codec
+
+	// bufs holds buffers for codecs implementing AppendCodec. nanomsg copies
+	// the message when it is sent, so the buffer can be reused right away.
+	bufs sync.Pool
+}
+
+// NewTypedSocket creates a typed socket sending and receiving on conn, which
+// usually is a *Socket or one of the socket wrappers.
+func NewTypedSocket[T any](conn Conn, codec Codec) *TypedSocket[T] {
+	return &TypedSocket[T]{Conn: conn, Codec: codec}
+}
+
+// Send encodes the value and sends it. If the value can not be encoded, a
+// *CodecError is returned.
+func (s *TypedSocket[T]) Send(v T) error {
+	if codec, ok := s.Codec.(AppendCodec); ok {
+		return s.sendAppend(codec, v)
+	}
+	data, err := s.Codec.Marshal(v)
+	if err != nil {
+		return &CodecError{"encode", s.Codec.Name(), err}
+	}
+	_, err = s.Conn.Send(data, 0)
+	return err
+}
+
+func (s *TypedSocket[T]) sendAppend(codec AppendCodec, v T) error {
+	buf, _ := s.bufs.Get().(*[]byte)
+	if buf == nil {
+		buf = new([]byte)
+	}
+	defer s.bufs.Put(buf)
+	data, err := codec.AppendMarshal((*buf)[:0], v)
+	if err != nil {
+		return &CodecError{"encode", codec.Name(), err}
+	}
+	*buf = data
+	_, err = s.Conn.Send(data, 0)
+	return err
+}
+
+// Recv receives a message and decodes it. If the message can not be decoded,
+// a *CodecError is returned.
+func (s *TypedSocket[T]) Recv() (T, error) {
+	var v T
+	data, err := s.Conn.Recv(0)
+	if err != nil {
+		return v, err
+	}
+	if err = s.Codec.Unmarshal(data, &v); err != nil {
+		return v, &CodecError{"decode", s.Codec.Name(), err}
+	}
+	return v, nil
+}
+
+// Close closes the underlying socket.
+func (s *TypedSocket[T]) Close() error {
+	return s.Conn.Close()
+}
+
+// JSONCodec encodes values as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values using encoding/gob. Each message is encoded on its
+// own and carries the type information needed to decode it.
+type GobCodec struct{}
+
+func (GobCodec) Name() string {
+	return "gob"
+}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// BinaryCodec encodes values in a binary format prefixed with its length as a
+// 32 bit big endian integer. Values implementing encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler are encoded using these, and other values using
+// encoding/binary, which requires them to be of fixed size.
+type BinaryCodec struct{}
+
+func (BinaryCodec) Name() string {
+	return "binary"
+}
+
+func (BinaryCodec) Marshal(v any) ([]byte, error) {
+	var payload []byte
+	if m, ok := v.(encoding.BinaryMarshaler); ok {
+		var err error
+		if payload, err = m.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			return nil, err
+		}
+		payload = buf.Bytes()
+	}
+	data := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(data, uint32(len(payload)))
+	return append(data, payload...), nil
+}
+
+func (BinaryCodec) Unmarshal(data []byte, v any) error {
+	if len(data) < 4 {
+		return errors.New("message too short")
+	}
+	size, payload := binary.BigEndian.Uint32(data), data[4:]
+	if int64(size) != int64(len(payload)) {
+		return fmt.Errorf("length prefix %d does not match payload of %d bytes", size, len(payload))
+	}
+	if u, ok := v.(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(payload)
+	}
+	r := bytes.NewReader(payload)
+	if err := binary.Read(r, binary.BigEndian, v); err != nil {
+		return err
+	} else if r.Len() != 0 {
+		return fmt.Errorf("%d bytes left after decoding", r.Len())
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Go binding for nanomsg
+
+package nanomsg
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/op/go-nanomsg/nanomsgtest"
+)
+
+type point struct {
+	X, Y int32
+}
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}, BinaryCodec{}} {
+		data, err := codec.Marshal(point{1, -2})
+		if err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		}
+		var p point
+		if err = codec.Unmarshal(data, &p); err != nil {
+			t.Fatalf("%s: %v", codec.Name(), err)
+		} else if p != (point{1, -2}) {
+			t.Errorf("%s: unexpected value: %+v", codec.Name(), p)
+		}
+	}
+
+	// netip.Addr implements encoding.BinaryMarshaler.
+	data, err := BinaryCodec{}.Marshal(netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(data) != 8 || data[3] != 4 {
+		t.Errorf("unexpected encoding: %v", data)
+	}
+	var addr netip.Addr
+	if err = (BinaryCodec{}).Unmarshal(data, &addr); err != nil {
+		t.Fatal(err)
+	} else if addr.String() != "127.0.0.1" {
+		t.Errorf("unexpected address: %v", addr)
+	}
+	if err = (BinaryCodec{}).Unmarshal(data[:7], &addr); err == nil {
+		t.Error("expected truncated message to fail")
+	}
+}
+
+func TestTypedSocket(t *testing.T) {
+	n := nanomsgtest.NewNetwork()
+	a, b := n.NewSocket(nanomsgtest.PAIR), n.NewSocket(nanomsgtest.PAIR)
+	if err := a.Bind("typed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Connect("typed"); err != nil {
+		t.Fatal(err)
+	}
+	sender := NewTypedSocket[point](a, JSONCodec{})
+	defer sender.Close()
+	receiver := NewTypedSocket[point](b, JSONCodec{})
+	defer receiver.Close()
+
+	if err := sender.Send(point{3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := receiver.Recv(); err != nil {
+		t.Fatal(err)
+	} else if p != (point{3, 4}) {
+		t.Errorf("unexpected value: %+v", p)
+	}
+
+	if _, err := a.Send([]byte("not json"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := receiver.Recv()
+	var cerr *CodecError
+	if !errors.As(err, &cerr) || cerr.Op != "decode" || cerr.Codec != "json" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}